@@ -0,0 +1,84 @@
+package mysql
+
+import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	BalancerPriority     = "priority"
+	BalancerWeighted     = "weighted"
+	BalancerRoundRobin   = "roundRobin"
+	BalancerLeastLatency = "leastLatency"
+)
+
+var (
+	ErrUnknownBalancer = errors.New("mysql group: unknown balancer")
+)
+
+// Balancer 从可用连接池中选择一个，返回pools的下标
+type Balancer interface {
+	Select(pools []*Pool) (index int)
+}
+
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", BalancerPriority:
+		return &PriorityBalancer{}, nil
+	case BalancerWeighted:
+		return &WeightedBalancer{}, nil
+	case BalancerRoundRobin:
+		return &RoundRobinBalancer{}, nil
+	case BalancerLeastLatency:
+		return &LeastLatencyBalancer{}, nil
+	}
+	return nil, ErrUnknownBalancer
+}
+
+// PriorityBalancer 按配置顺序选择第一个可用连接池
+type PriorityBalancer struct{}
+
+func (p *PriorityBalancer) Select(pools []*Pool) (index int) {
+	return 0
+}
+
+// WeightedBalancer 按PoolOption.Weight加权随机
+type WeightedBalancer struct{}
+
+func (w *WeightedBalancer) Select(pools []*Pool) (index int) {
+	total := 0
+	for _, pool := range pools {
+		total += pool.Weight()
+	}
+
+	value := rand.Intn(total)
+	for index, pool := range pools {
+		value -= pool.Weight()
+		if value < 0 {
+			return index
+		}
+	}
+	return len(pools) - 1
+}
+
+type RoundRobinBalancer struct {
+	counter uint64
+}
+
+func (r *RoundRobinBalancer) Select(pools []*Pool) (index int) {
+	return int(atomic.AddUint64(&r.counter, 1) % uint64(len(pools)))
+}
+
+// LeastLatencyBalancer 选择平均耗时最小的连接池，尚无统计数据的连接池优先
+type LeastLatencyBalancer struct{}
+
+func (l *LeastLatencyBalancer) Select(pools []*Pool) (index int) {
+	least := pools[0].Latency()
+	for i := 1; i < len(pools); i++ {
+		if latency := pools[i].Latency(); latency < least {
+			index, least = i, latency
+		}
+	}
+	return index
+}
@@ -0,0 +1,173 @@
+package mysql
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultBatchRows = 1000
+	//MySQL max_allowed_packet默认为4MB，预留部分空间
+	defaultBatchBytes = 4<<20 - 64<<10
+)
+
+type BatchOption struct {
+	//每批最大行数，默认为1000
+	MaxRows int `yaml:"maxRows" json:"maxRows"`
+	//每批sql及参数的估算字节数上限，默认略小于4MB
+	MaxBytes int `yaml:"maxBytes" json:"maxBytes"`
+	//是否在同一事务中执行所有批次
+	InTx bool `yaml:"inTx" json:"inTx"`
+}
+
+// add 累加影响行数，LastInsertId保留第一批的值，即本次插入的第一个自增id
+func (r *ExecResult) add(result *ExecResult) {
+	if result == nil {
+		return
+	}
+
+	if r.LastInsertId == 0 {
+		r.LastInsertId = result.LastInsertId
+	}
+	r.AffectedRows += result.AffectedRows
+}
+
+// splitRows 按行数和估算字节数拆分，单行超过MaxBytes时单独成批
+func splitRows(table string, rows []map[string]interface{}, option *BatchOption) (batches [][]map[string]interface{}) {
+	if len(rows) < 1 {
+		return nil
+	}
+
+	maxRows, maxBytes := defaultBatchRows, defaultBatchBytes
+	if option != nil {
+		if option.MaxRows > 0 {
+			maxRows = option.MaxRows
+		}
+		if option.MaxBytes > 0 {
+			maxBytes = option.MaxBytes
+		}
+	}
+
+	header := len(insertVerb) + len(table) + 16
+	for column, _ := range rows[0] {
+		header += len(column) + 3
+	}
+
+	var (
+		start = 0
+		size  = header
+	)
+
+	for index, row := range rows {
+		rowSize := estimateRowSize(row)
+		if index > start && (index-start >= maxRows || size+rowSize > maxBytes) {
+			batches = append(batches, rows[start:index])
+			start, size = index, header
+		}
+		size += rowSize
+	}
+
+	return append(batches, rows[start:])
+}
+
+func estimateRowSize(row map[string]interface{}) int {
+	size := 3
+	for _, value := range row {
+		size += estimateSize(value) + 2
+	}
+	return size
+}
+
+func estimateSize(value interface{}) int {
+	switch val := value.(type) {
+	case nil:
+		return 4
+	case string:
+		return len(val) + 2
+	case []byte:
+		return 2*len(val) + 3
+	case time.Time:
+		return 28
+	case bool:
+		return 1
+	}
+	return 20
+}
+
+// BatchInsertWithOption 按option拆分为多条INSERT语句执行，返回累计的结果
+func (p *Pool) BatchInsertWithOption(ctx context.Context, table string, rows []map[string]interface{}, option *BatchOption) (result *ExecResult, err error) {
+	batches := splitRows(table, rows, option)
+
+	if option != nil && option.InTx && len(batches) > 1 {
+		err = p.Transact(ctx, func(tx *Transaction) (e error) {
+			result, e = tx.batchInsert(ctx, table, batches)
+			return
+		})
+		return
+	}
+
+	result = &ExecResult{}
+	for _, batch := range batches {
+		sqlStr, args, err := buildInsertByMap(table, batch...)
+		if err != nil {
+			return result, err
+		}
+
+		res, err := p.ExecuteContext(ctx, sqlStr, args...)
+		if err != nil {
+			return result, err
+		}
+		result.add(res)
+	}
+	return result, nil
+}
+
+// BatchInsertWithOption 非事务模式下每批单独选择主库执行，失败时返回已成功批次的累计结果
+func (g *Group) BatchInsertWithOption(ctx context.Context, table string, rows []map[string]interface{}, option *BatchOption) (result *ExecResult, err error) {
+	batches := splitRows(table, rows, option)
+
+	if option != nil && option.InTx && len(batches) > 1 {
+		err = g.Transact(ctx, func(tx *Transaction) (e error) {
+			result, e = tx.batchInsert(ctx, table, batches)
+			return
+		})
+
+		if err == nil {
+			g.invalidate(table)
+		}
+		return
+	}
+
+	result = &ExecResult{}
+	for _, batch := range batches {
+		res, err := g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+			sqlStr, args, err := buildInsertByMap(table, batch...)
+			if err != nil {
+				return nil, err
+			}
+			return mPool.ExecuteContext(ctx, sqlStr, args...)
+		})
+		if err != nil {
+			return result, err
+		}
+		result.add(res)
+	}
+	return result, nil
+}
+
+func (t *Transaction) batchInsert(ctx context.Context, table string, batches [][]map[string]interface{}) (result *ExecResult, err error) {
+	result = &ExecResult{}
+	for _, batch := range batches {
+		sqlStr, args, err := buildInsertByMap(table, batch...)
+		if err != nil {
+			return result, err
+		}
+
+		res, err := t.exec(ctx, sqlStr, args)
+		if err != nil {
+			return result, err
+		}
+		result.add(res)
+	}
+	return result, nil
+}
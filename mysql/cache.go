@@ -0,0 +1,395 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grpc-boot/boot"
+	"github.com/grpc-boot/boot/redis"
+)
+
+const (
+	defaultCacheTtl    = 60
+	defaultCachePrefix = "mysql:cache:"
+)
+
+type CacheOption struct {
+	//key前缀，默认为"mysql:cache:"
+	Prefix string `yaml:"prefix" json:"prefix"`
+	//单位s，默认为60
+	Ttl int64 `yaml:"ttl" json:"ttl"`
+}
+
+// QueryCache 以表标签版本号失效的查询缓存，缓存key为前缀+sha1(所涉及表的版本号+sql+参数)，
+// 写入表时递增其版本号，旧缓存随TTL过期
+type QueryCache struct {
+	redis  *redis.Group
+	prefix string
+	ttl    int64
+	flight flightGroup
+}
+
+func NewQueryCache(group *redis.Group, option *CacheOption) *QueryCache {
+	cache := &QueryCache{
+		redis:  group,
+		prefix: defaultCachePrefix,
+		ttl:    defaultCacheTtl,
+	}
+
+	if option != nil {
+		if option.Prefix != "" {
+			cache.prefix = option.Prefix
+		}
+
+		if option.Ttl > 0 {
+			cache.ttl = option.Ttl
+		}
+	}
+
+	return cache
+}
+
+// Invalidate 递增表的标签版本号，使涉及该表的缓存失效
+func (c *QueryCache) Invalidate(tables ...string) (err error) {
+	for _, table := range tables {
+		if table == "" {
+			continue
+		}
+
+		e := c.do(c.tagKey(table), func(r *redis.Redis, key string) error {
+			_, e := r.Incr(key)
+			return e
+		})
+		if e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+func (c *QueryCache) tagKey(table string) string {
+	return c.prefix + "tag:" + normalizeTable(table)
+}
+
+// normalizeTable 去除引号及空白，使"`user`"与"user"、"`db`.`user`"与"db.user"对应同一个标签
+func normalizeTable(table string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '`', '"', ' ', '\t', '\n':
+			return -1
+		}
+		return r
+	}, table)
+}
+
+func (c *QueryCache) do(key string, handler func(r *redis.Redis, key string) error) error {
+	pool, err := c.redis.Get(key)
+	if err != nil {
+		return err
+	}
+
+	r := pool.Get()
+	defer pool.Put(r)
+
+	return handler(r, key)
+}
+
+// key 表版本号读取失败时返回错误，此时不使用缓存
+func (c *QueryCache) key(tables []string, sqlStr string, args []interface{}) (string, error) {
+	h := sha1.New()
+	for _, table := range tables {
+		var version int64
+		err := c.do(c.tagKey(table), func(r *redis.Redis, key string) (e error) {
+			value, e := r.Get(key)
+			if e != nil || value == nil {
+				return e
+			}
+
+			version, e = strconv.ParseInt(fmt.Sprintf("%s", value), 10, 64)
+			return e
+		})
+		if err != nil {
+			return "", err
+		}
+
+		_, _ = fmt.Fprintf(h, "%s:%d;", normalizeTable(table), version)
+	}
+
+	_, _ = h.Write([]byte(strings.Join(strings.Fields(sqlStr), " ")))
+	for _, arg := range args {
+		_, _ = fmt.Fprintf(h, ";%T:%v", arg, arg)
+	}
+
+	return c.prefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetch 缓存未命中时只有一个调用方执行load，其他并发调用方等待并共享结果；redis不可用时直接执行load
+func (c *QueryCache) fetch(tables []string, ttl int64, sqlStr string, args []interface{}, load func() (*rowSet, error)) (*rowSet, error) {
+	key, err := c.key(tables, sqlStr, args)
+	if err != nil {
+		return load()
+	}
+
+	var data []byte
+	_ = c.do(key, func(r *redis.Redis, key string) (e error) {
+		data, e = r.GetBytes(key)
+		return
+	})
+
+	if len(data) > 0 {
+		set := &rowSet{}
+		if json.Unmarshal(data, set) == nil {
+			return set, nil
+		}
+	}
+
+	if ttl < 1 {
+		ttl = c.ttl
+	}
+
+	value, err := c.flight.Do(key, func() (interface{}, error) {
+		set, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		if data, e := json.Marshal(set); e == nil {
+			_ = c.do(key, func(r *redis.Redis, key string) error {
+				_, e := r.SetEx(key, data, ttl)
+				return e
+			})
+		}
+		return set, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return value.(*rowSet), nil
+}
+
+// rowSet 可序列化的结果集，nil表示NULL
+type rowSet struct {
+	Columns []string   `json:"c"`
+	Rows    [][][]byte `json:"r"`
+}
+
+func scanRowSet(rows *sql.Rows) (set *rowSet, err error) {
+	defer rows.Close()
+
+	set = &rowSet{}
+	if set.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(set.Columns), len(set.Columns))
+	for rows.Next() {
+		row := make([][]byte, len(set.Columns), len(set.Columns))
+		for index, _ := range row {
+			values[index] = &row[index]
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return nil, err
+		}
+		set.Rows = append(set.Rows, row)
+	}
+
+	return set, rows.Err()
+}
+
+// fillObj 使用第一行填充obj，无数据时不修改obj
+func (s *rowSet) fillObj(obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTypes
+	}
+
+	if len(s.Rows) < 1 {
+		return nil
+	}
+
+	v = v.Elem()
+	return fillRow(v, s.fieldList(v.Type()), s.Rows[0])
+}
+
+func (s *rowSet) fillObjs(dest interface{}) error {
+	sliceValue := reflect.ValueOf(dest)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice {
+		return ErrInvalidSliceTypes
+	}
+	sliceValue = sliceValue.Elem()
+
+	var (
+		elemType = sliceValue.Type().Elem()
+		isPtr    = elemType.Kind() == reflect.Ptr
+	)
+
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	if elemType.Kind() != reflect.Struct {
+		return ErrInvalidSliceTypes
+	}
+
+	var (
+		fieldList = s.fieldList(elemType)
+		list      = reflect.MakeSlice(sliceValue.Type(), 0, len(s.Rows))
+	)
+
+	for _, row := range s.Rows {
+		elem := reflect.New(elemType).Elem()
+		if err := fillRow(elem, fieldList, row); err != nil {
+			return err
+		}
+
+		if isPtr {
+			list = reflect.Append(list, elem.Addr())
+		} else {
+			list = reflect.Append(list, elem)
+		}
+	}
+
+	sliceValue.Set(list)
+	return nil
+}
+
+func (s *rowSet) fieldList(t reflect.Type) []*fieldMeta {
+	var (
+		meta      = getModelMeta(t)
+		fieldList = make([]*fieldMeta, len(s.Columns), len(s.Columns))
+	)
+
+	for index, column := range s.Columns {
+		fieldList[index] = meta.columns[column]
+	}
+	return fieldList
+}
+
+func fillRow(elem reflect.Value, fieldList []*fieldMeta, row [][]byte) error {
+	for index, field := range fieldList {
+		if field == nil {
+			continue
+		}
+
+		if err := setField(elem.Field(field.index), row[index], field.json); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// flightGroup 相同key的并发调用只执行一次
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+func (f *flightGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	f.mutex.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*flightCall)
+	}
+
+	if call, exists := f.calls[key]; exists {
+		f.mutex.Unlock()
+		call.wg.Wait()
+		return call.val, call.err
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	f.calls[key] = call
+	f.mutex.Unlock()
+
+	defer func() {
+		call.wg.Done()
+		f.mutex.Lock()
+		delete(f.calls, key)
+		f.mutex.Unlock()
+	}()
+
+	call.val, call.err = fn()
+	return call.val, call.err
+}
+
+// SetCache 设置查询缓存，仅对调用了Query.Cache的FindOne和FindAll生效，
+// Find返回*sql.Rows，无法由缓存的结果集构造，不使用缓存
+func (g *Group) SetCache(cache *QueryCache) {
+	g.cache = cache
+}
+
+// InvalidateCache 用于Execute等无法识别表名的写入后手动失效缓存，Transact可通过TransactOption.Tables指定
+func (g *Group) InvalidateCache(tables ...string) error {
+	if g.cache == nil {
+		return nil
+	}
+	return g.cache.Invalidate(tables...)
+}
+
+// cachedRows 读主库(包括写后读)时不使用缓存；未命中时从主库加载，避免从库延迟使失效前的旧数据以新版本号写入缓存
+func (g *Group) cachedRows(ctx context.Context, query *Query, useMaster bool) (set *rowSet, ok bool, err error) {
+	if g.cache == nil || !query.cache || g.stickToMaster(ctx, useMaster) {
+		return nil, false, nil
+	}
+
+	sqlStr, args, err := buildQuery(query)
+	if err != nil {
+		return nil, true, err
+	}
+
+	defer func() {
+		boot.ReleaseArgs(&args)
+	}()
+
+	set, err = g.cache.fetch(query.tables(nil), query.cacheTtl, sqlStr, args, func() (*rowSet, error) {
+		rows, err := g.queryContext(ctx, true, sqlStr, args)
+		if err != nil {
+			return nil, err
+		}
+		return scanRowSet(rows)
+	})
+	return set, true, err
+}
+
+func (g *Group) invalidate(table string) {
+	if g.cache != nil && table != "" {
+		_ = g.cache.Invalidate(table)
+	}
+}
+
+// objTable obj为切片时使用第一个元素的表名
+func objTable(obj interface{}) string {
+	t := modelType(obj)
+	if t == nil {
+		return ""
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(obj))
+	if value.Kind() == reflect.Slice {
+		if value.Len() < 1 {
+			return getModelMeta(t).tableName(reflect.New(t))
+		}
+		value = reflect.Indirect(value.Index(0))
+	}
+
+	if !value.IsValid() {
+		value = reflect.New(t)
+	}
+	return getModelMeta(t).tableName(value)
+}
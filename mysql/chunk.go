@@ -0,0 +1,187 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+const (
+	defaultChunkSize = 1000
+)
+
+// ErrStopChunk handler返回该错误时停止遍历，Chunk和Each返回nil
+var ErrStopChunk = errors.New("mysql chunk: stop")
+
+var errStopEach = errors.New("mysql each: stop")
+
+type ChunkOption struct {
+	//游标字段，需唯一且有序，默认为主键
+	Key string
+	//每批数量，默认为1000
+	Size int64
+	//从该游标之后开始遍历，用于断点续传
+	Cursor interface{}
+}
+
+// ChunkHandler dest中为本批数据，cursor为本批最后一行的游标值
+type ChunkHandler func(cursor interface{}) error
+
+// EachHandler row为dest元素类型的单行数据
+type EachHandler func(row interface{}) error
+
+type finder func(ctx context.Context, query *Query, dest interface{}) error
+
+// chunk 按游标字段分批查询：WHERE key > cursor ORDER BY key LIMIT size，query中的排序及分页被替换，
+// 在query的副本上修改，不影响调用方；返回最后一个处理成功的批次的游标，出错时可以此续传
+func chunk(ctx context.Context, find finder, query *Query, dest interface{}, option *ChunkOption, handler ChunkHandler) (cursor interface{}, err error) {
+	var opt ChunkOption
+	if option != nil {
+		opt = *option
+	}
+
+	if opt.Size < 1 {
+		opt.Size = defaultChunkSize
+	}
+
+	t := modelType(dest)
+	if t == nil {
+		return nil, ErrInvalidSliceTypes
+	}
+
+	meta := getModelMeta(t)
+	if opt.Key == "" {
+		if len(meta.primaries) != 1 {
+			return nil, ErrNotFoundPrimaryField
+		}
+		opt.Key = meta.primaries[0].column
+	}
+
+	field, exists := meta.columns[opt.Key]
+	if !exists {
+		return nil, ErrNotFoundField
+	}
+
+	copied := *query
+	query = &copied
+
+	column := field.quoted
+	if query.alias != "" {
+		column = query.alias + "." + column
+	}
+
+	var (
+		where = query.where
+		rows  = reflect.ValueOf(dest)
+	)
+
+	if rows.Kind() != reflect.Ptr || rows.Elem().Kind() != reflect.Slice {
+		return nil, ErrInvalidSliceTypes
+	}
+	rows = rows.Elem()
+
+	cursor = opt.Cursor
+	query.order = " ORDER BY " + column
+	for {
+		if err = ctx.Err(); err != nil {
+			return cursor, err
+		}
+
+		query.where = where
+		if cursor != nil {
+			query.where = And(where, Gt(column, cursor))
+		}
+		query.offset, query.limit = 0, opt.Size
+
+		if err = find(ctx, query, dest); err != nil {
+			return cursor, err
+		}
+
+		if rows.Len() == 0 {
+			return cursor, nil
+		}
+
+		last := rows.Index(rows.Len() - 1)
+		if last.Kind() == reflect.Ptr {
+			last = last.Elem()
+		}
+		next := last.Field(field.index).Interface()
+
+		if err = handler(next); err != nil {
+			if err == ErrStopChunk {
+				return next, nil
+			}
+			return cursor, err
+		}
+
+		cursor = next
+		if int64(rows.Len()) < opt.Size {
+			return cursor, nil
+		}
+	}
+}
+
+// each 逐行调用handler，中途失败或停止时返回最后一个完整处理的批次的游标，续传时该批次会重新处理
+func each(ctx context.Context, find finder, query *Query, dest interface{}, option *ChunkOption, handler EachHandler) (cursor interface{}, err error) {
+	cursor, err = chunk(ctx, find, query, dest, option, func(cursor interface{}) error {
+		rows := reflect.ValueOf(dest).Elem()
+		for index := 0; index < rows.Len(); index++ {
+			if err := handler(rows.Index(index).Interface()); err != nil {
+				if err == ErrStopChunk {
+					return errStopEach
+				}
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err == errStopEach {
+		err = nil
+	}
+	return
+}
+
+// Chunk 按游标分批遍历，dest为*[]struct或*[]*struct，每批数据填充到dest后调用handler，
+// query中的ORDER BY、Limit及Offset被游标排序及分页替换
+func (p *Pool) Chunk(query *Query, dest interface{}, option *ChunkOption, handler ChunkHandler) (cursor interface{}, err error) {
+	return p.ChunkContext(context.Background(), query, dest, option, handler)
+}
+
+func (p *Pool) ChunkContext(ctx context.Context, query *Query, dest interface{}, option *ChunkOption, handler ChunkHandler) (cursor interface{}, err error) {
+	return chunk(ctx, p.FindAllContext, query, dest, option, handler)
+}
+
+// Each 按游标分批遍历，逐行调用handler，排序同Chunk
+func (p *Pool) Each(query *Query, dest interface{}, option *ChunkOption, handler EachHandler) (cursor interface{}, err error) {
+	return p.EachContext(context.Background(), query, dest, option, handler)
+}
+
+func (p *Pool) EachContext(ctx context.Context, query *Query, dest interface{}, option *ChunkOption, handler EachHandler) (cursor interface{}, err error) {
+	return each(ctx, p.FindAllContext, query, dest, option, handler)
+}
+
+// Chunk 按游标分批遍历，dest为*[]struct或*[]*struct，每批数据填充到dest后调用handler，
+// query中的ORDER BY、Limit及Offset被游标排序及分页替换
+func (g *Group) Chunk(query *Query, dest interface{}, useMaster bool, option *ChunkOption, handler ChunkHandler) (cursor interface{}, err error) {
+	return g.ChunkContext(context.Background(), query, dest, useMaster, option, handler)
+}
+
+func (g *Group) ChunkContext(ctx context.Context, query *Query, dest interface{}, useMaster bool, option *ChunkOption, handler ChunkHandler) (cursor interface{}, err error) {
+	return chunk(ctx, g.finder(useMaster), query, dest, option, handler)
+}
+
+// Each 按游标分批遍历，逐行调用handler，排序同Chunk
+func (g *Group) Each(query *Query, dest interface{}, useMaster bool, option *ChunkOption, handler EachHandler) (cursor interface{}, err error) {
+	return g.EachContext(context.Background(), query, dest, useMaster, option, handler)
+}
+
+func (g *Group) EachContext(ctx context.Context, query *Query, dest interface{}, useMaster bool, option *ChunkOption, handler EachHandler) (cursor interface{}, err error) {
+	return each(ctx, g.finder(useMaster), query, dest, option, handler)
+}
+
+func (g *Group) finder(useMaster bool) finder {
+	return func(ctx context.Context, query *Query, dest interface{}) error {
+		return g.FindAllContext(ctx, query, dest, useMaster)
+	}
+}
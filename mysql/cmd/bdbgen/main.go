@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grpc-boot/boot/mysql"
+)
+
+var (
+	dsn     = flag.String("dsn", "", "mysql dsn, eg: root:123456@tcp(127.0.0.1:3306)/test")
+	tables  = flag.String("tables", "", "comma separated table names, default all tables")
+	pkg     = flag.String("package", "model", "package name of the generated file")
+	out     = flag.String("out", "", "output file, default stdout")
+	timeout = flag.Duration("timeout", 10*time.Second, "timeout for reading information_schema")
+)
+
+func main() {
+	flag.Parse()
+
+	if *dsn == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pool, err := mysql.NewPool(&mysql.PoolOption{Dsn: *dsn, MaxOpenConns: 1, MaxIdleConns: 1})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Db().Close()
+
+	option := &mysql.GenerateOption{Package: *pkg}
+	if *tables != "" {
+		option.Tables = strings.Split(*tables, ",")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	source, err := mysql.Generate(ctx, pool, option)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *out == "" {
+		_, _ = os.Stdout.Write(source)
+		return
+	}
+
+	if err = ioutil.WriteFile(*out, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
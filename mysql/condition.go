@@ -0,0 +1,445 @@
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Condition interface {
+	Build(buf *bytes.Buffer, args []interface{}) []interface{}
+}
+
+type compareCondition struct {
+	field    string
+	operator string
+	value    interface{}
+}
+
+func (c *compareCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteString(c.field)
+	buf.WriteByte(' ')
+	buf.WriteString(c.operator)
+	buf.WriteString(" ?")
+	return append(args, c.value)
+}
+
+type inCondition struct {
+	field  string
+	not    bool
+	values []interface{}
+}
+
+func (c *inCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	//IN()为空时恒为假，NOT IN()为空时恒为真
+	if len(c.values) == 0 {
+		if c.not {
+			buf.WriteString("1=1")
+		} else {
+			buf.WriteString("1=0")
+		}
+		return args
+	}
+
+	buf.WriteString(c.field)
+	if c.not {
+		buf.WriteString(" NOT")
+	}
+	buf.WriteString(" IN(")
+	buf.WriteString(strings.Repeat(inHolder, len(c.values))[:2*len(c.values)-1])
+	buf.WriteByte(')')
+	return append(args, c.values...)
+}
+
+type betweenCondition struct {
+	field string
+	not   bool
+	start interface{}
+	end   interface{}
+}
+
+func (c *betweenCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteString(c.field)
+	if c.not {
+		buf.WriteString(" NOT")
+	}
+	buf.WriteString(" BETWEEN ? AND ?")
+	return append(args, c.start, c.end)
+}
+
+type nullCondition struct {
+	field string
+	not   bool
+}
+
+func (c *nullCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteString(c.field)
+	if c.not {
+		buf.WriteString(" IS NOT NULL")
+	} else {
+		buf.WriteString(" IS NULL")
+	}
+	return args
+}
+
+type rawCondition struct {
+	sql  string
+	args []interface{}
+}
+
+func (c *rawCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteString(c.sql)
+	return append(args, c.args...)
+}
+
+type logicCondition struct {
+	operator   string
+	conditions []Condition
+}
+
+func (c *logicCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteByte('(')
+	for index, condition := range c.conditions {
+		if index > 0 {
+			buf.WriteByte(' ')
+			buf.WriteString(c.operator)
+			buf.WriteByte(' ')
+		}
+		args = parenthesize(condition).Build(buf, args)
+	}
+	buf.WriteByte(')')
+	return args
+}
+
+// groupCondition 为条件加上括号，避免Raw等条件中的OR改变外层逻辑
+type groupCondition struct {
+	condition Condition
+}
+
+func (c *groupCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteByte('(')
+	args = c.condition.Build(buf, args)
+	buf.WriteByte(')')
+	return args
+}
+
+// parenthesize 内置的比较及逻辑条件原样返回，Raw及自定义条件加上括号
+func parenthesize(condition Condition) Condition {
+	switch condition.(type) {
+	case nil, *compareCondition, *inCondition, *betweenCondition, *nullCondition, *logicCondition,
+		*notCondition, *subQueryCondition, *invalidCondition, *groupCondition:
+		return condition
+	}
+	return &groupCondition{condition: condition}
+}
+
+// invalidCondition 字段或操作符不合法，构建时返回错误，未检查直接使用时恒为假
+type invalidCondition struct {
+	err error
+}
+
+func (c *invalidCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteString("1=0")
+	return args
+}
+
+// conditionErr 返回条件中第一个不合法的字段或操作符错误
+func conditionErr(condition Condition) error {
+	switch c := condition.(type) {
+	case *invalidCondition:
+		return c.err
+	case *logicCondition:
+		for _, item := range c.conditions {
+			if err := conditionErr(item); err != nil {
+				return err
+			}
+		}
+	case *notCondition:
+		return conditionErr(c.condition)
+	case *groupCondition:
+		return conditionErr(c.condition)
+	case *subQueryCondition:
+		return c.query.check()
+	}
+	return nil
+}
+
+type notCondition struct {
+	condition Condition
+}
+
+func (c *notCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	buf.WriteString("NOT (")
+	args = c.condition.Build(buf, args)
+	buf.WriteByte(')')
+	return args
+}
+
+// Compare field需为标识符，operator需在白名单中，见QuoteIdentifier
+func Compare(field string, operator string, value interface{}) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+
+	operator, err = normalizeOperator(operator)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &compareCondition{field: quoted, operator: operator, value: value}
+}
+
+func Eq(field string, value interface{}) Condition {
+	return Compare(field, "=", value)
+}
+
+func Neq(field string, value interface{}) Condition {
+	return Compare(field, "<>", value)
+}
+
+func Gt(field string, value interface{}) Condition {
+	return Compare(field, ">", value)
+}
+
+func Gte(field string, value interface{}) Condition {
+	return Compare(field, ">=", value)
+}
+
+func Lt(field string, value interface{}) Condition {
+	return Compare(field, "<", value)
+}
+
+func Lte(field string, value interface{}) Condition {
+	return Compare(field, "<=", value)
+}
+
+func Like(field string, value interface{}) Condition {
+	return Compare(field, "LIKE", value)
+}
+
+func NotLike(field string, value interface{}) Condition {
+	return Compare(field, "NOT LIKE", value)
+}
+
+func In(field string, values ...interface{}) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &inCondition{field: quoted, values: values}
+}
+
+func NotIn(field string, values ...interface{}) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &inCondition{field: quoted, not: true, values: values}
+}
+
+func Between(field string, start, end interface{}) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &betweenCondition{field: quoted, start: start, end: end}
+}
+
+func NotBetween(field string, start, end interface{}) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &betweenCondition{field: quoted, not: true, start: start, end: end}
+}
+
+func IsNull(field string) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &nullCondition{field: quoted}
+}
+
+func IsNotNull(field string) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &nullCondition{field: quoted, not: true}
+}
+
+func Raw(sql string, args ...interface{}) Condition {
+	return &rawCondition{sql: sql, args: args}
+}
+
+// And nil条件会被忽略，全部为nil时返回nil
+func And(conditions ...Condition) Condition {
+	return newLogic("AND", conditions)
+}
+
+// Or nil条件会被忽略，全部为nil时返回nil
+func Or(conditions ...Condition) Condition {
+	return newLogic("OR", conditions)
+}
+
+func Not(condition Condition) Condition {
+	if condition == nil {
+		return nil
+	}
+	return &notCondition{condition: condition}
+}
+
+func newLogic(operator string, conditions []Condition) Condition {
+	list := make([]Condition, 0, len(conditions))
+	for _, condition := range conditions {
+		if condition != nil {
+			list = append(list, condition)
+		}
+	}
+
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+
+	return &logicCondition{operator: operator, conditions: list}
+}
+
+// MapCondition 兼容map形式的条件，key格式为"字段 操作符"，按key排序后以AND连接，
+// 字段及操作符不合法时在构建sql时返回错误
+func MapCondition(where map[string]interface{}) Condition {
+	if len(where) < 1 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(where))
+	for field, _ := range where {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	conditions := make([]Condition, 0, len(fields))
+	for _, key := range fields {
+		var (
+			field    = key
+			operator = "="
+			position = strings.Index(key, " ")
+		)
+
+		if position > 0 {
+			operator = key[position+1:]
+			field = key[:position]
+		}
+
+		//"IS"及"IS NOT"仅支持nil值，转为IS NULL及IS NOT NULL
+		if isOperator := strings.ToUpper(strings.Join(strings.Fields(operator), " ")); isOperator == "IS" || isOperator == "IS NOT" {
+			switch {
+			case where[key] != nil:
+				conditions = append(conditions, &invalidCondition{err: fmt.Errorf("%w: %q requires nil value", ErrInvalidOperator, operator)})
+			case isOperator == "IS":
+				conditions = append(conditions, IsNull(field))
+			default:
+				conditions = append(conditions, IsNotNull(field))
+			}
+			continue
+		}
+
+		operator, err := normalizeOperator(operator)
+		if err != nil {
+			conditions = append(conditions, &invalidCondition{err: err})
+			continue
+		}
+
+		val, isList := where[key].([]interface{})
+		if !isList {
+			conditions = append(conditions, Compare(field, operator, where[key]))
+			continue
+		}
+
+		switch operator {
+		case "BETWEEN", "NOT BETWEEN":
+			var start, end interface{}
+			if len(val) > 0 {
+				start = val[0]
+			}
+			if len(val) > 1 {
+				end = val[1]
+			}
+
+			if operator == "BETWEEN" {
+				conditions = append(conditions, Between(field, start, end))
+			} else {
+				conditions = append(conditions, NotBetween(field, start, end))
+			}
+		case "NOT IN":
+			conditions = append(conditions, NotIn(field, val...))
+		default:
+			conditions = append(conditions, In(field, val...))
+		}
+	}
+
+	return And(conditions...)
+}
+
+type subQueryCondition struct {
+	field    string
+	operator string
+	query    *Query
+}
+
+func (c *subQueryCondition) Build(buf *bytes.Buffer, args []interface{}) []interface{} {
+	if c.field != "" {
+		buf.WriteString(c.field)
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(c.operator)
+	buf.WriteString(" (")
+	//MySQL不支持IN子查询中使用LIMIT，EXISTS子查询仅在显式设置时生成LIMIT
+	args = c.query.build(buf, args, c.query.limited && (c.operator == "EXISTS" || c.operator == "NOT EXISTS"))
+	buf.WriteByte(')')
+	return args
+}
+
+// On 连接条件，如On("u.id", "o.user_id")，两侧均需为标识符
+func On(left string, right string) Condition {
+	quotedLeft, err := QuoteIdentifier(left)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+
+	quotedRight, err := QuoteIdentifier(right)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return Raw(quotedLeft + " = " + quotedRight)
+}
+
+// InQuery IN子查询，子查询的LIMIT会被忽略
+func InQuery(field string, query *Query) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &subQueryCondition{field: quoted, operator: "IN", query: query}
+}
+
+// NotInQuery NOT IN子查询，子查询的LIMIT会被忽略
+func NotInQuery(field string, query *Query) Condition {
+	quoted, err := QuoteIdentifier(field)
+	if err != nil {
+		return &invalidCondition{err: err}
+	}
+	return &subQueryCondition{field: quoted, operator: "NOT IN", query: query}
+}
+
+func Exists(query *Query) Condition {
+	return &subQueryCondition{operator: "EXISTS", query: query}
+}
+
+func NotExists(query *Query) Condition {
+	return &subQueryCondition{operator: "NOT EXISTS", query: query}
+}
@@ -0,0 +1,275 @@
+package mysql
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	DialectMysql    = "mysql"
+	DialectPostgres = "postgres"
+	DialectSqlite   = "sqlite"
+)
+
+var (
+	ErrUnknownDialect     = errors.New("mysql: unknown dialect")
+	ErrUnsupportedDialect = errors.New("mysql: unsupported by dialect")
+)
+
+// Dialect 数据库方言。构建器统一生成MySQL形式的sql(?占位符、反引号、LIMIT offset,limit)，
+// 执行前由Rebind转换为目标数据库的形式；迁移、代码生成及GET_LOCK等功能仅支持MySQL
+type Dialect interface {
+	Name() string
+	//sql.Open使用的默认驱动名，需自行导入对应驱动
+	Driver() string
+	//转换占位符、标识符引号及LIMIT，字符串字面量及双引号标识符中的内容保持不变
+	Rebind(sql string) string
+	Limit(offset int64, limit int64) string
+	//冲突时更新的子句，keys为冲突检测字段，updateColumns为需要更新的字段，不支持时返回ErrUnsupportedDialect
+	Upsert(keys []string, updateColumns []string) (string, error)
+	//是否支持REPLACE INTO
+	SupportsReplace() bool
+}
+
+func NewDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "", DialectMysql:
+		return MysqlDialect{}, nil
+	case DialectPostgres, "postgresql", "pgsql":
+		return PostgresDialect{}, nil
+	case DialectSqlite, "sqlite3":
+		return SqliteDialect{}, nil
+	}
+	return nil, ErrUnknownDialect
+}
+
+type MysqlDialect struct{}
+
+func (m MysqlDialect) Name() string {
+	return DialectMysql
+}
+
+func (m MysqlDialect) Driver() string {
+	return "mysql"
+}
+
+func (m MysqlDialect) Rebind(sql string) string {
+	return sql
+}
+
+func (m MysqlDialect) Limit(offset int64, limit int64) string {
+	return " LIMIT " + strconv.FormatInt(offset, 10) + "," + strconv.FormatInt(limit, 10)
+}
+
+func (m MysqlDialect) SupportsReplace() bool {
+	return true
+}
+
+func (m MysqlDialect) Upsert(keys []string, updateColumns []string) (string, error) {
+	buf := bytes.NewBufferString(" ON DUPLICATE KEY UPDATE ")
+	for index, column := range updateColumns {
+		if index > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(column)
+		buf.WriteString("=VALUES(")
+		buf.WriteString(column)
+		buf.WriteByte(')')
+	}
+	return buf.String(), nil
+}
+
+// PostgresDialect 占位符为$1、$2...；DO UPDATE必须指定冲突字段，UpsertObj以主键作为冲突字段，
+// map形式的Upsert需通过UpsertWithOption指定Keys，未指定及Replace返回ErrUnsupportedDialect
+type PostgresDialect struct{}
+
+func (p PostgresDialect) Name() string {
+	return DialectPostgres
+}
+
+func (p PostgresDialect) Driver() string {
+	return "postgres"
+}
+
+func (p PostgresDialect) Rebind(sql string) string {
+	return rebind(sql, '"', true, p.Limit)
+}
+
+func (p PostgresDialect) Limit(offset int64, limit int64) string {
+	return standardLimit(offset, limit)
+}
+
+func (p PostgresDialect) SupportsReplace() bool {
+	return false
+}
+
+func (p PostgresDialect) Upsert(keys []string, updateColumns []string) (string, error) {
+	if len(keys) == 0 {
+		return "", ErrUnsupportedDialect
+	}
+	return onConflict(keys, updateColumns), nil
+}
+
+// SqliteDialect 要求SQLite 3.24及以上版本，未指定冲突字段时要求3.35及以上版本；
+// 本包不包含SQLite驱动，需自行导入并通过PoolOption.Driver指定驱动名
+type SqliteDialect struct{}
+
+func (s SqliteDialect) Name() string {
+	return DialectSqlite
+}
+
+func (s SqliteDialect) Driver() string {
+	return "sqlite3"
+}
+
+func (s SqliteDialect) Rebind(sql string) string {
+	return rebind(sql, '"', false, s.Limit)
+}
+
+func (s SqliteDialect) Limit(offset int64, limit int64) string {
+	return standardLimit(offset, limit)
+}
+
+func (s SqliteDialect) SupportsReplace() bool {
+	return true
+}
+
+func (s SqliteDialect) Upsert(keys []string, updateColumns []string) (string, error) {
+	return onConflict(keys, updateColumns), nil
+}
+
+func standardLimit(offset int64, limit int64) string {
+	return " LIMIT " + strconv.FormatInt(limit, 10) + " OFFSET " + strconv.FormatInt(offset, 10)
+}
+
+func onConflict(keys []string, updateColumns []string) string {
+	buf := bytes.NewBufferString(" ON CONFLICT")
+	if len(keys) > 0 {
+		buf.WriteByte('(')
+		buf.WriteString(strings.Join(keys, ","))
+		buf.WriteByte(')')
+	}
+
+	buf.WriteString(" DO UPDATE SET ")
+	for index, column := range updateColumns {
+		if index > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(column)
+		buf.WriteString("=EXCLUDED.")
+		buf.WriteString(column)
+	}
+	return buf.String()
+}
+
+// rebind 将反引号标识符转换为以quote引用，numbered为true时将?替换为$n，并将LIMIT offset,limit转换为limit生成的形式；
+// 字符串字面量及双引号标识符中的内容保持不变
+func rebind(sql string, quote byte, numbered bool, limit func(offset int64, limit int64) string) string {
+	var (
+		buf   strings.Builder
+		index int
+	)
+
+	buf.Grow(len(sql) + 16)
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case ch == '\'':
+			end := literalEnd(sql, i)
+			buf.WriteString(sql[i:end])
+			i = end - 1
+		case ch == '"':
+			end, _ := identifierEnd(sql, i)
+			buf.WriteString(sql[i:end])
+			i = end - 1
+		case ch == '`':
+			end, closed := identifierEnd(sql, i)
+			name := sql[i+1 : end]
+			if closed {
+				name = sql[i+1 : end-1]
+			}
+			name = strings.ReplaceAll(name, "``", "`")
+			buf.WriteByte(quote)
+			buf.WriteString(strings.ReplaceAll(name, string(quote), string([]byte{quote, quote})))
+			buf.WriteByte(quote)
+			i = end - 1
+		case ch == '?' && numbered:
+			index++
+			buf.WriteByte('$')
+			buf.WriteString(strconv.Itoa(index))
+		case ch == 'L' && i > 0 && sql[i-1] == ' ' && strings.HasPrefix(sql[i:], "LIMIT "):
+			offset, count, end, ok := parseLimit(sql, i+len("LIMIT "))
+			if !ok {
+				buf.WriteByte(ch)
+				continue
+			}
+			buf.WriteString(strings.TrimPrefix(limit(offset, count), " "))
+			i = end - 1
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	return buf.String()
+}
+
+// literalEnd 返回字符串字面量结束后的下标，支持反斜杠转义及重复引号转义
+func literalEnd(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// identifierEnd 返回引号标识符结束后的下标，支持重复引号转义，不支持反斜杠转义
+func identifierEnd(sql string, start int) (end int, closed bool) {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1, true
+	}
+	return len(sql), false
+}
+
+// parseLimit 解析"offset,limit"形式，不是该形式时ok为false
+func parseLimit(sql string, start int) (offset int64, limit int64, end int, ok bool) {
+	comma := start
+	for comma < len(sql) && sql[comma] >= '0' && sql[comma] <= '9' {
+		comma++
+	}
+
+	if comma == start || comma >= len(sql) || sql[comma] != ',' {
+		return 0, 0, 0, false
+	}
+
+	end = comma + 1
+	for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+		end++
+	}
+
+	if end == comma+1 {
+		return 0, 0, 0, false
+	}
+
+	offset, _ = strconv.ParseInt(sql[start:comma], 10, 64)
+	limit, _ = strconv.ParseInt(sql[comma+1:end], 10, 64)
+	return offset, limit, end, true
+}
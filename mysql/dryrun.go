@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDryRun dry-run模式下无法返回结果集及开启事务
+var ErrDryRun = errors.New("mysql: statement recorded in dry-run mode and not executed")
+
+// recorder dry-run模式下记录语句
+type recorder struct {
+	mutex      sync.Mutex
+	statements []Statement
+}
+
+func (r *recorder) record(p *Pool, sqlStr string, args []interface{}) {
+	//参数可能在执行后被回收复用，需要复制
+	statement := Statement{
+		Sql:   sqlStr,
+		Args:  append([]interface{}{}, args...),
+		Pool:  p,
+		Start: time.Now(),
+	}
+
+	r.mutex.Lock()
+	r.statements = append(r.statements, statement)
+	r.mutex.Unlock()
+}
+
+// DryRun 是否为dry-run模式，该模式下写入语句只记录不执行并返回空的ExecResult，查询及开启事务返回ErrDryRun
+func (p *Pool) DryRun() bool {
+	return p.recorder != nil
+}
+
+// Statements dry-run模式下已记录的语句
+func (p *Pool) Statements() []Statement {
+	if p.recorder == nil {
+		return nil
+	}
+
+	p.recorder.mutex.Lock()
+	defer p.recorder.mutex.Unlock()
+	return append([]Statement{}, p.recorder.statements...)
+}
+
+func (p *Pool) ResetStatements() {
+	if p.recorder == nil {
+		return
+	}
+
+	p.recorder.mutex.Lock()
+	p.recorder.statements = nil
+	p.recorder.mutex.Unlock()
+}
@@ -0,0 +1,129 @@
+package mysql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// ExplainRow EXPLAIN输出的一行，不同MySQL版本缺少的列为零值
+type ExplainRow struct {
+	Id           int64
+	SelectType   string
+	Table        string
+	Type         string
+	PossibleKeys string
+	Key          string
+	Rows         int64
+	Filtered     float64
+	Extra        string
+}
+
+// FullScan type为ALL时为全表扫描
+func (e ExplainRow) FullScan() bool {
+	return e.Type == "ALL"
+}
+
+func (e ExplainRow) Filesort() bool {
+	return strings.Contains(e.Extra, "Using filesort")
+}
+
+type ExplainResult struct {
+	Sql  string
+	Args []interface{}
+	Rows []ExplainRow
+	//任意一行为全表扫描
+	FullScan bool
+	//任意一行使用了filesort
+	Filesort bool
+}
+
+// FullScanTables 全表扫描的表
+func (e *ExplainResult) FullScanTables() (tables []string) {
+	for _, row := range e.Rows {
+		if row.FullScan() {
+			tables = append(tables, row.Table)
+		}
+	}
+	return
+}
+
+// Explain 执行EXPLAIN并分析结果，不回收Query
+func (p *Pool) Explain(ctx context.Context, query *Query) (result *ExplainResult, err error) {
+	sqlStr, args, err := query.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.QueryContext(ctx, "EXPLAIN "+sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := scanRowSet(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseExplain(sqlStr, args, set), nil
+}
+
+// Explain 在从库执行，useMaster为true时在主库执行
+func (g *Group) Explain(ctx context.Context, query *Query, useMaster bool) (result *ExplainResult, err error) {
+	var (
+		res     interface{}
+		handler = func(mPool *Pool) (interface{}, error) {
+			return mPool.Explain(ctx, query)
+		}
+	)
+
+	if useMaster {
+		res, err = g.MasterExecContext(ctx, handler)
+	} else {
+		res, err = g.SlaveQueryContext(ctx, handler)
+	}
+
+	result, _ = res.(*ExplainResult)
+	return result, err
+}
+
+func parseExplain(sqlStr string, args []interface{}, set *rowSet) *ExplainResult {
+	result := &ExplainResult{
+		Sql:  sqlStr,
+		Args: args,
+		Rows: make([]ExplainRow, 0, len(set.Rows)),
+	}
+
+	for _, values := range set.Rows {
+		var row ExplainRow
+		for index, column := range set.Columns {
+			value := string(values[index])
+			switch strings.ToLower(column) {
+			case "id":
+				row.Id, _ = strconv.ParseInt(value, 10, 64)
+			case "select_type":
+				row.SelectType = value
+			case "table":
+				row.Table = value
+			case "type":
+				row.Type = value
+			case "possible_keys":
+				row.PossibleKeys = value
+			case "key":
+				row.Key = value
+			case "rows":
+				row.Rows, _ = strconv.ParseInt(value, 10, 64)
+			case "filtered":
+				row.Filtered, _ = strconv.ParseFloat(value, 64)
+			case "extra":
+				row.Extra = value
+			}
+		}
+
+		result.FullScan = result.FullScan || row.FullScan()
+		result.Filesort = result.Filesort || row.Filesort()
+		result.Rows = append(result.Rows, row)
+	}
+
+	return result
+}
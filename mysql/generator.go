@@ -0,0 +1,241 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+type Column struct {
+	Name       string
+	DataType   string
+	ColumnType string
+	Nullable   bool
+	Key        string
+	Extra      string
+	Default    sql.NullString
+	Comment    string
+}
+
+func (c Column) IsPrimary() bool {
+	return c.Key == "PRI"
+}
+
+func (c Column) IsAutoIncrement() bool {
+	return strings.Contains(c.Extra, "auto_increment")
+}
+
+// IsRequired 非空、无默认值且非自增的字段在插入时必须提供
+func (c Column) IsRequired() bool {
+	return !c.Nullable && !c.Default.Valid && !c.IsAutoIncrement()
+}
+
+type GenerateOption struct {
+	Package string
+	//为空时生成当前库下的所有表
+	Tables []string
+}
+
+func LoadTables(ctx context.Context, pool *Pool) (tables []string, err error) {
+	rows, err := pool.QueryContext(ctx, "SELECT `TABLE_NAME` FROM `information_schema`.`TABLES` WHERE `TABLE_SCHEMA` = DATABASE() AND `TABLE_TYPE` = 'BASE TABLE' ORDER BY `TABLE_NAME`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func LoadColumns(ctx context.Context, pool *Pool, table string) (columns []Column, err error) {
+	rows, err := pool.QueryContext(ctx, "SELECT `COLUMN_NAME`,`DATA_TYPE`,`COLUMN_TYPE`,`IS_NULLABLE`,`COLUMN_KEY`,`EXTRA`,`COLUMN_DEFAULT`,`COLUMN_COMMENT` "+
+		"FROM `information_schema`.`COLUMNS` WHERE `TABLE_SCHEMA` = DATABASE() AND `TABLE_NAME` = ? ORDER BY `ORDINAL_POSITION`", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			column   Column
+			nullable string
+		)
+
+		err = rows.Scan(&column.Name, &column.DataType, &column.ColumnType, &nullable, &column.Key, &column.Extra, &column.Default, &column.Comment)
+		if err != nil {
+			return nil, err
+		}
+
+		column.Nullable = nullable == "YES"
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// Generate 读取information_schema生成带bdb标签的结构体源码
+func Generate(ctx context.Context, pool *Pool, option *GenerateOption) ([]byte, error) {
+	tables := option.Tables
+	if len(tables) == 0 {
+		var err error
+		if tables, err = LoadTables(ctx, pool); err != nil {
+			return nil, err
+		}
+	}
+
+	structs := make(map[string][]Column, len(tables))
+	for _, table := range tables {
+		columns, err := LoadColumns(ctx, pool, table)
+		if err != nil {
+			return nil, err
+		}
+		structs[table] = columns
+	}
+
+	return GenerateSource(option.Package, structs)
+}
+
+func GenerateSource(pkg string, tables map[string][]Column) ([]byte, error) {
+	var (
+		names   = make([]string, 0, len(tables))
+		imports = make(map[string]bool)
+		body    = bytes.NewBuffer(nil)
+	)
+
+	for table, _ := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	for _, table := range names {
+		writeStruct(body, table, tables[table], imports)
+	}
+
+	buf := bytes.NewBufferString("// Code generated by bdbgen. DO NOT EDIT.\n\npackage " + pkg + "\n\n")
+	if len(imports) > 0 {
+		paths := make([]string, 0, len(imports))
+		for path, _ := range imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		buf.WriteString("import (\n")
+		for _, path := range paths {
+			buf.WriteString("\t\"" + path + "\"\n")
+		}
+		buf.WriteString(")\n\n")
+	}
+	buf.Write(body.Bytes())
+
+	return format.Source(buf.Bytes())
+}
+
+func writeStruct(buf *bytes.Buffer, table string, columns []Column, imports map[string]bool) {
+	name := camelCase(table)
+
+	buf.WriteString("type " + name + " struct {\n")
+	for _, column := range columns {
+		goType, pkg := goType(column)
+		if pkg != "" {
+			imports[pkg] = true
+		}
+
+		tag := column.Name
+		if column.IsPrimary() {
+			tag += "," + primary
+		}
+		if column.IsRequired() && !column.IsPrimary() {
+			tag += "," + required
+		}
+
+		buf.WriteString("\t" + camelCase(column.Name) + " " + goType + " `" + tagName + ":\"" + tag + "\"`")
+		if column.Comment != "" {
+			buf.WriteString(" //" + strings.Replace(column.Comment, "\n", " ", -1))
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("}\n\n")
+
+	receiver := strings.ToLower(name[:1])
+	buf.WriteString("func (" + receiver + " " + name + ") " + tableMethod + "() string {\n")
+	buf.WriteString("\treturn `" + table + "`\n")
+	buf.WriteString("}\n\n")
+}
+
+// goType 返回字段的Go类型及需要导入的包，可为NULL的字段使用指针以区分NULL与零值
+func goType(column Column) (goType string, pkg string) {
+	goType, pkg = baseType(column)
+	if column.Nullable && goType != "[]byte" {
+		goType = "*" + goType
+	}
+	return
+}
+
+func baseType(column Column) (goType string, pkg string) {
+	unsigned := strings.Contains(column.ColumnType, "unsigned")
+	prefix := ""
+	if unsigned {
+		prefix = "u"
+	}
+
+	switch column.DataType {
+	case "tinyint":
+		if strings.HasPrefix(column.ColumnType, "tinyint(1)") {
+			return "bool", ""
+		}
+		return prefix + "int8", ""
+	case "smallint":
+		return prefix + "int16", ""
+	case "mediumint", "int", "integer":
+		return prefix + "int32", ""
+	case "bigint":
+		return prefix + "int64", ""
+	case "float":
+		return "float32", ""
+	case "double", "real":
+		return "float64", ""
+	case "bit":
+		return "uint64", ""
+	case "date", "datetime", "timestamp":
+		return "time.Time", "time"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "[]byte", ""
+	}
+
+	//decimal使用string避免精度丢失
+	return "string", ""
+}
+
+func camelCase(name string) string {
+	var (
+		buf   strings.Builder
+		upper = true
+	)
+
+	for _, ch := range name {
+		if ch == '_' || ch == '-' || ch == ' ' {
+			upper = true
+			continue
+		}
+
+		if upper && ch >= 'a' && ch <= 'z' {
+			ch -= 'a' - 'A'
+		}
+		upper = false
+		buf.WriteRune(ch)
+	}
+
+	result := buf.String()
+	if result != "" && result[0] >= '0' && result[0] <= '9' {
+		result = "T" + result
+	}
+	return result
+}
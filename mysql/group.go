@@ -7,10 +7,11 @@ import (
 	"errors"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grpc-boot/boot"
-	"github.com/grpc-boot/boot/atomic"
 )
 
 var (
@@ -23,18 +24,36 @@ type GroupOption struct {
 	Slaves  []PoolOption `yaml:"slaves" json:"slaves"`
 	//单位s
 	RetryInterval int64 `yaml:"retryInterval" json:"retryInterval"`
+	//单位ms，上下文中的Session写入后该时间内的读请求走主库，0为关闭
+	StickyInterval int64 `yaml:"stickyInterval" json:"stickyInterval"`
+	//连接池选择策略：priority(默认)、weighted、roundRobin、leastLatency
+	Balancer string `yaml:"balancer" json:"balancer"`
+	//单位s，主动探测不可用连接池的间隔，0为关闭
+	HealthCheckInterval int64 `yaml:"healthCheckInterval" json:"healthCheckInterval"`
 }
 
 type Group struct {
 	masters map[int]*Pool
 	slaves  map[int]*Pool
 
-	masterBadPool map[int]*atomic.Int64
-	slaveBadPool  map[int]*atomic.Int64
+	masterStates map[int]*poolState
+	slaveStates  map[int]*poolState
+	//StateHandler，健康检查协程中读取，使用atomic.Value避免数据竞争
+	stateHandler atomic.Value
 
-	retryInterval int64
-	masterLen     int
-	slaveLen      int
+	checkerMutex sync.Mutex
+	checker      *healthChecker
+
+	//balancerHolder，SetBalancer可与查询并发调用，使用atomic.Value避免数据竞争
+	masterBalancer atomic.Value
+	slaveBalancer  atomic.Value
+
+	retryInterval  int64
+	stickyInterval time.Duration
+	masterLen      int
+	slaveLen       int
+
+	cache *QueryCache
 }
 
 func NewGroup(groupOption *GroupOption) *Group {
@@ -43,12 +62,21 @@ func NewGroup(groupOption *GroupOption) *Group {
 	}
 
 	group := &Group{
-		masterLen:     len(groupOption.Masters),
-		slaveLen:      len(groupOption.Slaves),
-		retryInterval: groupOption.RetryInterval,
-		masterBadPool: make(map[int]*atomic.Int64, len(groupOption.Masters)),
-		slaveBadPool:  make(map[int]*atomic.Int64, len(groupOption.Slaves)),
+		masterLen:      len(groupOption.Masters),
+		slaveLen:       len(groupOption.Slaves),
+		retryInterval:  groupOption.RetryInterval,
+		stickyInterval: time.Duration(groupOption.StickyInterval) * time.Millisecond,
+		masterStates:   make(map[int]*poolState, len(groupOption.Masters)),
+		slaveStates:    make(map[int]*poolState, len(groupOption.Slaves)),
+	}
+
+	masterBalancer, err := NewBalancer(groupOption.Balancer)
+	if err != nil {
+		panic(err.Error())
 	}
+	slaveBalancer, _ := NewBalancer(groupOption.Balancer)
+	group.masterBalancer.Store(balancerHolder{masterBalancer})
+	group.slaveBalancer.Store(balancerHolder{slaveBalancer})
 
 	group.masters = make(map[int]*Pool, group.masterLen)
 	group.slaves = make(map[int]*Pool, group.slaveLen)
@@ -60,7 +88,7 @@ func NewGroup(groupOption *GroupOption) *Group {
 		}
 
 		group.masters[index] = pool
-		group.masterBadPool[index] = &atomic.Int64{}
+		group.masterStates[index] = &poolState{}
 	}
 
 	for index, _ := range groupOption.Slaves {
@@ -70,124 +98,170 @@ func NewGroup(groupOption *GroupOption) *Group {
 		}
 
 		group.slaves[index] = pool
-		group.slaveBadPool[index] = &atomic.Int64{}
+		group.slaveStates[index] = &poolState{}
+	}
+
+	if groupOption.HealthCheckInterval > 0 {
+		group.StartHealthCheck(time.Duration(groupOption.HealthCheckInterval) * time.Second)
 	}
 
 	return group
 }
 
-func (g *Group) down(index int, isMaster bool) {
+func (g *Group) down(index int, isMaster bool, reason error) {
+	states := g.slaveStates
 	if isMaster {
-		g.downMaster(index)
+		states = g.masterStates
+	}
+
+	if index >= len(states) || !states[index].down(reason) {
 		return
 	}
-	g.downSlave(index)
+
+	if handler := g.loadStateHandler(); handler != nil {
+		handler(index, isMaster, true, reason)
+	}
 }
 
 func (g *Group) up(index int, isMaster bool) {
+	states := g.slaveStates
 	if isMaster {
-		g.upMaster(index)
-		return
+		states = g.masterStates
 	}
-	g.upSlave(index)
-}
 
-func (g *Group) downMaster(index int) {
-	if index >= g.masterLen {
+	if index >= len(states) || !states[index].up() {
 		return
 	}
 
-	if g.masterBadPool[index].Get() > 0 {
-		return
+	if handler := g.loadStateHandler(); handler != nil {
+		handler(index, isMaster, false, nil)
 	}
-	g.masterBadPool[index].Cas(0, time.Now().Unix())
+}
+
+func (g *Group) downMaster(index int, reason error) {
+	g.down(index, true, reason)
 }
 
 func (g *Group) upMaster(index int) {
-	if index >= g.masterLen {
-		return
-	}
-	g.masterBadPool[index].Set(0)
+	g.up(index, true)
 }
 
-func (g *Group) downSlave(index int) {
-	if index >= g.slaveLen {
-		return
+func (g *Group) downSlave(index int, reason error) {
+	g.down(index, false, reason)
+}
+
+func (g *Group) upSlave(index int) {
+	g.up(index, false)
+}
+
+// Use 为所有主从连接池注册Interceptor，需在使用Group前调用
+func (g *Group) Use(interceptors ...Interceptor) {
+	for index := 0; index < len(g.masters); index++ {
+		g.masters[index].Use(interceptors...)
 	}
 
-	if g.slaveBadPool[index].Get() > 0 {
-		return
+	for index := 0; index < len(g.slaves); index++ {
+		g.slaves[index].Use(interceptors...)
 	}
-	g.slaveBadPool[index].Cas(0, time.Now().Unix())
 }
 
-func (g *Group) upSlave(index int) {
-	if index >= g.slaveLen {
-		return
-	}
-	g.slaveBadPool[index].Set(0)
+// OnStateChange 可在健康检查启动后设置，设置前发生的状态变化不会回调
+func (g *Group) OnStateChange(handler StateHandler) {
+	g.stateHandler.Store(handler)
+}
+
+func (g *Group) loadStateHandler() StateHandler {
+	handler, _ := g.stateHandler.Load().(StateHandler)
+	return handler
 }
 
 func (g *Group) GetBadPool(isMaster bool) (list []int) {
+	states := g.slaveStates
 	if isMaster {
-		list = make([]int, 0, g.masterLen)
-		for index := 0; index < g.masterLen; index++ {
-			if g.masterBadPool[index].Get() > 0 {
-				list = append(list, index)
-			}
-		}
-		return
+		states = g.masterStates
 	}
 
-	list = make([]int, 0, g.slaveLen)
-	for index := 0; index < g.slaveLen; index++ {
-		if g.slaveBadPool[index].Get() > 0 {
+	list = make([]int, 0, len(states))
+	for index := 0; index < len(states); index++ {
+		if states[index].get() > 0 {
 			list = append(list, index)
 		}
 	}
 	return
 }
 
-func (g *Group) GetMaster() (index int, mPoll *Pool, badTime int64) {
-	if g.masterLen == 1 {
-		return 0, g.masters[0], g.masterBadPool[0].Get()
+func (g *Group) GetBadPoolDetail(isMaster bool) (list []BadPool) {
+	states := g.slaveStates
+	if isMaster {
+		states = g.masterStates
 	}
 
-	current := time.Now().Unix()
-	for index, mPoll = range g.masters {
-		badTime = g.masterBadPool[index].Get()
-		if badTime == 0 {
-			return index, mPoll, badTime
+	list = make([]BadPool, 0, len(states))
+	for index := 0; index < len(states); index++ {
+		if states[index].get() > 0 {
+			list = append(list, states[index].detail(index))
 		}
+	}
+	return
+}
 
-		if badTime+g.retryInterval < current {
-			g.masterBadPool[index].Set(current)
-			return index, mPoll, badTime
-		}
+// balancerHolder atomic.Value要求每次存储的类型一致，不同的Balancer实现需包装后存储
+type balancerHolder struct {
+	Balancer
+}
+
+// SetBalancer 可在运行中调用
+func (g *Group) SetBalancer(isMaster bool, balancer Balancer) {
+	if isMaster {
+		g.masterBalancer.Store(balancerHolder{balancer})
+		return
 	}
+	g.slaveBalancer.Store(balancerHolder{balancer})
+}
 
-	return 0, g.masters[0], g.masterBadPool[0].Get()
+func loadBalancer(value *atomic.Value) Balancer {
+	return value.Load().(balancerHolder).Balancer
+}
+
+func (g *Group) GetMaster() (index int, mPoll *Pool, badTime int64) {
+	return g.selectFrom(g.masters, g.masterStates, loadBalancer(&g.masterBalancer))
 }
 
 func (g *Group) GetSlave() (index int, mPoll *Pool, badTime int64) {
-	if g.slaveLen == 1 {
-		return 0, g.slaves[0], g.slaveBadPool[0].Get()
+	return g.selectFrom(g.slaves, g.slaveStates, loadBalancer(&g.slaveBalancer))
+}
+
+func (g *Group) selectFrom(pools map[int]*Pool, states map[int]*poolState, balancer Balancer) (index int, mPoll *Pool, badTime int64) {
+	if len(pools) == 1 {
+		return 0, pools[0], states[0].get()
 	}
 
-	current := time.Now().Unix()
-	for index, mPoll = range g.slaves {
-		badTime = g.slaveBadPool[index].Get()
-		if badTime == 0 {
-			return index, mPoll, badTime
-		}
+	var (
+		current    = time.Now().Unix()
+		candidates = make([]*Pool, 0, len(pools))
+		indexes    = make([]int, 0, len(pools))
+	)
 
-		if badTime+g.retryInterval < current {
-			g.slaveBadPool[index].Set(current)
-			return index, mPoll, badTime
+	//可用或已到重试时间的连接池
+	for index = 0; index < len(pools); index++ {
+		badTime = states[index].get()
+		if badTime == 0 || badTime+g.retryInterval < current {
+			candidates = append(candidates, pools[index])
+			indexes = append(indexes, index)
 		}
 	}
 
-	return 0, g.slaves[0], g.slaveBadPool[0].Get()
+	if len(candidates) == 0 {
+		return 0, pools[0], states[0].get()
+	}
+
+	index = indexes[balancer.Select(candidates)]
+	badTime = states[index].get()
+	if badTime > 0 {
+		states[index].retry(current)
+	}
+
+	return index, pools[index], badTime
 }
 
 func (g *Group) SelectPool(isMaster bool) (index int, mPool *Pool, badTime int64) {
@@ -198,31 +272,29 @@ func (g *Group) SelectPool(isMaster bool) (index int, mPool *Pool, badTime int64
 }
 
 func (g *Group) BeginTx(ctx context.Context, opts *sql.TxOptions) (trans *Transaction, err error) {
-	tx, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.db.BeginTx(ctx, opts)
+	tx, err := g.MasterExecContext(ctx, func(mPool *Pool) (i interface{}, e error) {
+		return mPool.BeginTx(ctx, opts)
 	})
 	if err != nil {
 		return nil, err
 	}
-	return newTx(tx.(*sql.Tx)), err
+
+	g.markWrite(ctx)
+	return tx.(*Transaction), err
 }
 
 func (g *Group) Begin() (trans *Transaction, err error) {
-	tx, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.db.Begin()
-	})
-	if err != nil {
-		return nil, err
-	}
-	return newTx(tx.(*sql.Tx)), err
+	return g.BeginTx(context.Background(), nil)
 }
 
 func (g *Group) isLostError(err error) bool {
-	if err == driver.ErrBadConn {
+	if errors.Is(err, driver.ErrBadConn) {
 		return true
 	}
 
-	if errVal, ok := err.(*net.OpError); ok {
+	//事务中的错误可能被包装
+	var errVal *net.OpError
+	if errors.As(err, &errVal) {
 		log.Printf("exec sql error:%s", errVal.Error())
 		return true
 	}
@@ -230,10 +302,21 @@ func (g *Group) isLostError(err error) bool {
 }
 
 func (g *Group) MasterExec(handler func(mPool *Pool) (interface{}, error)) (result interface{}, err error) {
+	return g.MasterExecContext(context.Background(), handler)
+}
+
+func (g *Group) MasterExecContext(ctx context.Context, handler func(mPool *Pool) (interface{}, error)) (result interface{}, err error) {
 	for start := 0; start < g.masterLen; start++ {
+		//上下文已取消或超时，不再重试
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		index, pool, badTime := g.GetMaster()
+		begin := time.Now()
 		result, err = handler(pool)
 		if err == nil {
+			pool.observe(time.Since(begin))
 			if badTime > 0 {
 				g.upMaster(index)
 			}
@@ -242,7 +325,7 @@ func (g *Group) MasterExec(handler func(mPool *Pool) (interface{}, error)) (resu
 		}
 
 		if g.isLostError(err) {
-			g.downMaster(index)
+			g.downMaster(index, err)
 			continue
 		}
 
@@ -256,10 +339,21 @@ func (g *Group) MasterExec(handler func(mPool *Pool) (interface{}, error)) (resu
 }
 
 func (g *Group) SlaveQuery(handler func(mPool *Pool) (interface{}, error)) (result interface{}, err error) {
+	return g.SlaveQueryContext(context.Background(), handler)
+}
+
+func (g *Group) SlaveQueryContext(ctx context.Context, handler func(mPool *Pool) (interface{}, error)) (result interface{}, err error) {
 	for start := 0; start < g.slaveLen; start++ {
+		//上下文已取消或超时，不再重试
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		index, pool, badTime := g.GetSlave()
+		begin := time.Now()
 		result, err = handler(pool)
 		if err == nil {
+			pool.observe(time.Since(begin))
 			if badTime > 0 {
 				g.upSlave(index)
 			}
@@ -268,7 +362,7 @@ func (g *Group) SlaveQuery(handler func(mPool *Pool) (interface{}, error)) (resu
 		}
 
 		if g.isLostError(err) {
-			g.downSlave(index)
+			g.downSlave(index, err)
 			continue
 		}
 
@@ -281,112 +375,261 @@ func (g *Group) SlaveQuery(handler func(mPool *Pool) (interface{}, error)) (resu
 	return nil, ErrNoSlaveConn
 }
 
-func (g *Group) Insert(table string, columns map[string]interface{}) (result *ExecResult, err error) {
-	res, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.Insert(table, columns)
+// execContext table为写入的表名，成功后使其查询缓存失效
+func (g *Group) execContext(ctx context.Context, table string, handler func(mPool *Pool) (*ExecResult, error)) (result *ExecResult, err error) {
+	res, err := g.MasterExecContext(ctx, func(mPool *Pool) (i interface{}, e error) {
+		return handler(mPool)
 	})
 
-	return res.(*ExecResult), err
+	if err == nil {
+		g.markWrite(ctx)
+		g.invalidate(table)
+	}
+
+	result, _ = res.(*ExecResult)
+	return result, err
+}
+
+func (g *Group) markWrite(ctx context.Context) {
+	if g.stickyInterval <= 0 {
+		return
+	}
+
+	if session := SessionFromContext(ctx); session != nil {
+		session.MarkWrite()
+	}
+}
+
+// stickToMaster 写后读，Session在StickyInterval内有写入时走主库
+func (g *Group) stickToMaster(ctx context.Context, useMaster bool) bool {
+	if useMaster || g.stickyInterval <= 0 {
+		return useMaster
+	}
+
+	session := SessionFromContext(ctx)
+	return session != nil && session.Sticky(g.stickyInterval)
+}
+
+func (g *Group) queryContext(ctx context.Context, useMaster bool, sqlStr string, args []interface{}) (rows *sql.Rows, err error) {
+	var (
+		result  interface{}
+		handler = func(mPool *Pool) (i interface{}, e error) {
+			return mPool.QueryContext(ctx, sqlStr, args...)
+		}
+	)
+
+	if g.stickToMaster(ctx, useMaster) {
+		result, err = g.MasterExecContext(ctx, handler)
+	} else {
+		result, err = g.SlaveQueryContext(ctx, handler)
+	}
+
+	rows, _ = result.(*sql.Rows)
+	return rows, err
+}
+
+func (g *Group) Insert(table string, columns map[string]interface{}) (result *ExecResult, err error) {
+	return g.InsertContext(context.Background(), table, columns)
+}
+
+func (g *Group) InsertContext(ctx context.Context, table string, columns map[string]interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.InsertContext(ctx, table, columns)
+	})
 }
 
 func (g *Group) BatchInsert(table string, rows []map[string]interface{}) (result *ExecResult, err error) {
-	res, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.BatchInsert(table, rows)
+	return g.BatchInsertContext(context.Background(), table, rows)
+}
+
+// BatchInsertContext 按默认的行数及字节数上限拆分执行，见BatchInsertWithOption
+func (g *Group) BatchInsertContext(ctx context.Context, table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return g.BatchInsertWithOption(ctx, table, rows, nil)
+}
+
+func (g *Group) Upsert(table string, columns map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return g.UpsertContext(context.Background(), table, columns, updateColumns...)
+}
+
+func (g *Group) UpsertContext(ctx context.Context, table string, columns map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.UpsertContext(ctx, table, columns, updateColumns...)
 	})
+}
 
-	return res.(*ExecResult), err
+func (g *Group) BatchUpsert(table string, rows []map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return g.BatchUpsertContext(context.Background(), table, rows, updateColumns...)
 }
 
-func (g *Group) UpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
-	res, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.UpdateAll(table, set, where)
+func (g *Group) BatchUpsertContext(ctx context.Context, table string, rows []map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.BatchUpsertContext(ctx, table, rows, updateColumns...)
 	})
+}
 
-	return res.(*ExecResult), err
+// UpsertWithOption PostgreSQL需通过option.Keys指定冲突检测字段
+func (g *Group) UpsertWithOption(ctx context.Context, table string, rows []map[string]interface{}, option *UpsertOption) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.UpsertWithOption(ctx, table, rows, option)
+	})
 }
 
-func (g *Group) DeleteAll(table string, where map[string]interface{}) (result *ExecResult, err error) {
-	res, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.DeleteAll(table, where)
+func (g *Group) Replace(table string, columns map[string]interface{}) (result *ExecResult, err error) {
+	return g.ReplaceContext(context.Background(), table, columns)
+}
+
+func (g *Group) ReplaceContext(ctx context.Context, table string, columns map[string]interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.ReplaceContext(ctx, table, columns)
 	})
+}
 
-	return res.(*ExecResult), err
+func (g *Group) BatchReplace(table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return g.BatchReplaceContext(context.Background(), table, rows)
 }
 
-func (g *Group) Find(query *Query, useMaster bool) (rows *sql.Rows, err error) {
-	var (
-		result       interface{}
-		sqlStr, args = buildQuery(query)
-	)
+func (g *Group) BatchReplaceContext(ctx context.Context, table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.BatchReplaceContext(ctx, table, rows)
+	})
+}
 
-	defer func() {
-		boot.ReleaseArgs(&args)
-	}()
+func (g *Group) UpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
+	return g.UpdateAllContext(context.Background(), table, set, where)
+}
 
-	if useMaster {
-		result, err = g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-			return mPool.db.Query(sqlStr, args...)
-		})
+func (g *Group) UpdateAllContext(ctx context.Context, table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.UpdateAllContext(ctx, table, set, where)
+	})
+}
 
-		return result.(*sql.Rows), err
-	}
+func (g *Group) DeleteAll(table string, where map[string]interface{}) (result *ExecResult, err error) {
+	return g.DeleteAllContext(context.Background(), table, where)
+}
 
-	result, err = g.SlaveQuery(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.db.Query(sqlStr, args...)
+func (g *Group) DeleteAllContext(ctx context.Context, table string, where map[string]interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, table, func(mPool *Pool) (*ExecResult, error) {
+		return mPool.DeleteAllContext(ctx, table, where)
 	})
+}
+
+func (g *Group) Find(query *Query, useMaster bool) (rows *sql.Rows, err error) {
+	return g.FindContext(context.Background(), query, useMaster)
+}
+
+func (g *Group) FindContext(ctx context.Context, query *Query, useMaster bool) (rows *sql.Rows, err error) {
+	sqlStr, args, err := buildQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		boot.ReleaseArgs(&args)
+	}()
 
-	return result.(*sql.Rows), err
+	return g.queryContext(ctx, useMaster, sqlStr, args)
 }
 
 func (g *Group) FindOne(obj interface{}, query *Query, useMaster bool) (err error) {
+	return g.FindOneContext(context.Background(), obj, query, useMaster)
+}
+
+func (g *Group) FindOneContext(ctx context.Context, obj interface{}, query *Query, useMaster bool) (err error) {
 	query.limit = 1
 
-	var (
-		result       interface{}
-		sqlStr, args = buildQuery(query)
-	)
+	set, cached, err := g.cachedRows(ctx, query.Model(obj), useMaster)
+	if cached {
+		if err != nil {
+			return err
+		}
+		return set.fillObj(obj)
+	}
+
+	sqlStr, args, err := buildQuery(query)
+	if err != nil {
+		return err
+	}
 
 	defer func() {
 		boot.ReleaseArgs(&args)
 	}()
 
-	if useMaster {
-		result, err = g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-			return mPool.db.Query(sqlStr, args...)
-		})
-	} else {
-		result, err = g.SlaveQuery(func(mPool *Pool) (i interface{}, e error) {
-			return mPool.db.Query(sqlStr, args...)
-		})
+	rows, err := g.queryContext(ctx, useMaster, sqlStr, args)
+	if err != nil {
+		return
+	}
+
+	return Row2Obj(rows, obj)
+}
+
+func (g *Group) FindAll(query *Query, dest interface{}, useMaster bool) (err error) {
+	return g.FindAllContext(context.Background(), query, dest, useMaster)
+}
+
+func (g *Group) FindAllContext(ctx context.Context, query *Query, dest interface{}, useMaster bool) (err error) {
+	set, cached, err := g.cachedRows(ctx, query.Model(dest), useMaster)
+	if cached {
+		if err != nil {
+			return err
+		}
+		return set.fillObjs(dest)
 	}
 
+	rows, err := g.FindContext(ctx, query, useMaster)
 	if err != nil {
 		return
 	}
 
-	return Row2Obj(result.(*sql.Rows), obj)
+	return Rows2Objs(rows, dest)
 }
 
 func (g *Group) InsertObj(obj interface{}) (result *ExecResult, err error) {
-	res, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.InsertObj(obj)
+	return g.InsertObjContext(context.Background(), obj)
+}
+
+func (g *Group) InsertObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, objTable(obj), func(mPool *Pool) (*ExecResult, error) {
+		return mPool.InsertObjContext(ctx, obj)
 	})
+}
 
-	return res.(*ExecResult), err
+func (g *Group) UpsertObj(obj interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return g.UpsertObjContext(context.Background(), obj, updateColumns...)
 }
 
-func (g *Group) DeleteObj(obj interface{}) (result *ExecResult, err error) {
-	res, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.DeleteObj(obj)
+func (g *Group) UpsertObjContext(ctx context.Context, obj interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return g.execContext(ctx, objTable(obj), func(mPool *Pool) (*ExecResult, error) {
+		return mPool.UpsertObjContext(ctx, obj, updateColumns...)
 	})
+}
 
-	return res.(*ExecResult), err
+func (g *Group) ReplaceObj(obj interface{}) (result *ExecResult, err error) {
+	return g.ReplaceObjContext(context.Background(), obj)
 }
 
-func (g *Group) UpdateObj(obj interface{}) (result *ExecResult, err error) {
-	res, err := g.MasterExec(func(mPool *Pool) (i interface{}, e error) {
-		return mPool.UpdateObj(obj)
+func (g *Group) ReplaceObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, objTable(obj), func(mPool *Pool) (*ExecResult, error) {
+		return mPool.ReplaceObjContext(ctx, obj)
 	})
+}
+
+func (g *Group) DeleteObj(obj interface{}) (result *ExecResult, err error) {
+	return g.DeleteObjContext(context.Background(), obj)
+}
 
-	return res.(*ExecResult), err
+func (g *Group) DeleteObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, objTable(obj), func(mPool *Pool) (*ExecResult, error) {
+		return mPool.DeleteObjContext(ctx, obj)
+	})
+}
+
+func (g *Group) UpdateObj(obj interface{}) (result *ExecResult, err error) {
+	return g.UpdateObjContext(context.Background(), obj)
+}
+
+func (g *Group) UpdateObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	return g.execContext(ctx, objTable(obj), func(mPool *Pool) (*ExecResult, error) {
+		return mPool.UpdateObjContext(ctx, obj)
+	})
 }
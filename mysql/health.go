@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPingTimeout = 3 * time.Second
+)
+
+// StateHandler 连接池状态变化回调，isDown为false时表示恢复可用
+type StateHandler func(index int, isMaster bool, isDown bool, reason error)
+
+type BadPool struct {
+	Index  int
+	DownAt time.Time
+	Reason error
+}
+
+type poolState struct {
+	//不可用时为最近一次标记或重试的时间，0为可用
+	badTime int64
+
+	mutex  sync.RWMutex
+	downAt time.Time
+	reason error
+}
+
+func (s *poolState) get() int64 {
+	return atomic.LoadInt64(&s.badTime)
+}
+
+func (s *poolState) retry(current int64) {
+	atomic.StoreInt64(&s.badTime, current)
+}
+
+func (s *poolState) down(reason error) (changed bool) {
+	now := time.Now()
+	if !atomic.CompareAndSwapInt64(&s.badTime, 0, now.Unix()) {
+		return false
+	}
+
+	s.mutex.Lock()
+	s.downAt = now
+	s.reason = reason
+	s.mutex.Unlock()
+	return true
+}
+
+func (s *poolState) up() (changed bool) {
+	return atomic.SwapInt64(&s.badTime, 0) > 0
+}
+
+func (s *poolState) detail(index int) BadPool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return BadPool{
+		Index:  index,
+		DownAt: s.downAt,
+		Reason: s.reason,
+	}
+}
+
+type healthChecker struct {
+	interval time.Duration
+	done     chan struct{}
+}
+
+// StartHealthCheck 定时探测不可用的连接池，恢复后重新加入选择，重复调用会先停止之前的探测
+func (g *Group) StartHealthCheck(interval time.Duration) {
+	g.StopHealthCheck()
+
+	checker := &healthChecker{
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+
+	g.checkerMutex.Lock()
+	g.checker = checker
+	g.checkerMutex.Unlock()
+
+	go g.healthCheck(checker)
+}
+
+func (g *Group) StopHealthCheck() {
+	g.checkerMutex.Lock()
+	defer g.checkerMutex.Unlock()
+
+	if g.checker != nil {
+		close(g.checker.done)
+		g.checker = nil
+	}
+}
+
+func (g *Group) healthCheck(checker *healthChecker) {
+	ticker := time.NewTicker(checker.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-checker.done:
+			return
+		case <-ticker.C:
+			g.probe(true)
+			g.probe(false)
+		}
+	}
+}
+
+func (g *Group) probe(isMaster bool) {
+	pools, states := g.slaves, g.slaveStates
+	if isMaster {
+		pools, states = g.masters, g.masterStates
+	}
+
+	for index := 0; index < len(pools); index++ {
+		if states[index].get() == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultPingTimeout)
+		err := pools[index].db.PingContext(ctx)
+		cancel()
+
+		if err == nil {
+			g.up(index, isMaster)
+		}
+	}
+}
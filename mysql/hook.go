@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Statement 经过Pool或Transaction执行的sql语句，Args在After返回后可能被回收复用，不可持有
+type Statement struct {
+	Sql      string
+	Args     []interface{}
+	Pool     *Pool
+	InTx     bool
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Interceptor Before按注册顺序调用，After按注册逆序调用
+type Interceptor interface {
+	Before(ctx context.Context, stmt *Statement) context.Context
+	After(ctx context.Context, stmt *Statement)
+}
+
+// AfterFunc 只关心执行结果的Interceptor
+type AfterFunc func(ctx context.Context, stmt *Statement)
+
+func (a AfterFunc) Before(ctx context.Context, stmt *Statement) context.Context {
+	return ctx
+}
+
+func (a AfterFunc) After(ctx context.Context, stmt *Statement) {
+	a(ctx, stmt)
+}
+
+func intercept(ctx context.Context, interceptors []Interceptor, stmt *Statement, handler func(ctx context.Context) error) error {
+	if len(interceptors) == 0 {
+		return handler(ctx)
+	}
+
+	for _, interceptor := range interceptors {
+		ctx = interceptor.Before(ctx, stmt)
+	}
+
+	stmt.Start = time.Now()
+	stmt.Err = handler(ctx)
+	stmt.Duration = time.Since(stmt.Start)
+
+	for index := len(interceptors) - 1; index >= 0; index-- {
+		interceptors[index].After(ctx, stmt)
+	}
+
+	return stmt.Err
+}
+
+type SlowQueryLogger struct {
+	threshold time.Duration
+	redact    bool
+	logger    *log.Logger
+}
+
+// NewSlowQueryLogger 记录耗时超过threshold的语句，redact为true时隐藏参数值，logger为nil时使用标准库log
+func NewSlowQueryLogger(threshold time.Duration, redact bool, logger *log.Logger) *SlowQueryLogger {
+	return &SlowQueryLogger{
+		threshold: threshold,
+		redact:    redact,
+		logger:    logger,
+	}
+}
+
+func (s *SlowQueryLogger) Before(ctx context.Context, stmt *Statement) context.Context {
+	return ctx
+}
+
+func (s *SlowQueryLogger) After(ctx context.Context, stmt *Statement) {
+	if stmt.Duration < s.threshold {
+		return
+	}
+
+	args := stmt.Args
+	if s.redact {
+		args = RedactArgs(args)
+	}
+
+	format, values := "mysql slow query: pool=%s duration=%s sql=%s args=%v err=%v", []interface{}{stmt.Pool.Name(), stmt.Duration, stmt.Sql, args, stmt.Err}
+	if s.logger != nil {
+		s.logger.Printf(format, values...)
+		return
+	}
+	log.Printf(format, values...)
+}
+
+// RedactArgs 将参数值替换为类型描述，如<string>
+func RedactArgs(args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args), len(args))
+	for index, arg := range args {
+		redacted[index] = fmt.Sprintf("<%T>", arg)
+	}
+	return redacted
+}
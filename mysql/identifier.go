@@ -0,0 +1,211 @@
+package mysql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidIdentifier = errors.New("mysql: invalid identifier")
+	ErrInvalidOperator   = errors.New("mysql: invalid operator")
+	ErrInvalidExpression = errors.New("mysql: invalid expression")
+)
+
+var (
+	identifierPattern = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_$]*$")
+	aliasPattern      = regexp.MustCompile("(?is)^(.*\\S)\\s+AS\\s+(\\S+)$")
+	aggregatePattern  = regexp.MustCompile("(?is)^(COUNT|SUM|AVG|MIN|MAX)\\s*\\(\\s*(DISTINCT\\s+)?(.+?)\\s*\\)$")
+	orderPattern      = regexp.MustCompile("(?is)^(.*\\S)\\s+(ASC|DESC)$")
+
+	// operators 允许在条件中使用的比较操作符
+	operators = map[string]bool{
+		"=":           true,
+		"<>":          true,
+		"!=":          true,
+		">":           true,
+		">=":          true,
+		"<":           true,
+		"<=":          true,
+		"<=>":         true,
+		"LIKE":        true,
+		"NOT LIKE":    true,
+		"IN":          true,
+		"NOT IN":      true,
+		"BETWEEN":     true,
+		"NOT BETWEEN": true,
+	}
+)
+
+// QuoteIdentifier 校验并以反引号引用标识符，支持"col"、"t.col"、"db.t.col"、"t.*"、"*"，
+// 各部分可以已带反引号，如"u.`id`"
+func QuoteIdentifier(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "*" {
+		return name, nil
+	}
+
+	parts := strings.Split(name, ".")
+	if len(parts) > 3 {
+		return "", identifierError(name)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(name)+2*len(parts)))
+	for index, part := range parts {
+		if index > 0 {
+			buf.WriteByte('.')
+		}
+
+		switch {
+		case part == "*" && index > 0 && index == len(parts)-1:
+			buf.WriteByte('*')
+		case len(part) > 2 && part[0] == '`' && part[len(part)-1] == '`' && strings.IndexByte(part[1:len(part)-1], '`') < 0:
+			buf.WriteString(part)
+		case identifierPattern.MatchString(part):
+			buf.WriteByte('`')
+			buf.WriteString(part)
+			buf.WriteByte('`')
+		default:
+			return "", identifierError(name)
+		}
+	}
+	return buf.String(), nil
+}
+
+func identifierError(name string) error {
+	return fmt.Errorf("%w: %q", ErrInvalidIdentifier, name)
+}
+
+// normalizeOperator 转为大写并合并空白，不在白名单中时返回错误
+func normalizeOperator(operator string) (string, error) {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(operator), " "))
+	if !operators[normalized] {
+		return "", fmt.Errorf("%w: %q", ErrInvalidOperator, operator)
+	}
+	return normalized, nil
+}
+
+// quoteColumns 用于Select，每项为标识符或COUNT、SUM、AVG、MIN、MAX聚合，可带"AS 别名"，
+// 其他表达式需使用SelectRaw
+func quoteColumns(columns []string) (string, error) {
+	list := make([]string, 0, len(columns))
+	for _, column := range splitList(columns) {
+		var alias string
+		if match := aliasPattern.FindStringSubmatch(column); match != nil {
+			quoted, err := QuoteIdentifier(match[2])
+			if err != nil || strings.IndexByte(quoted, '.') >= 0 || quoted == "*" {
+				return "", identifierError(match[2])
+			}
+			column, alias = match[1], " AS "+quoted
+		}
+
+		quoted, err := quoteColumn(column)
+		if err != nil {
+			return "", err
+		}
+		list = append(list, quoted+alias)
+	}
+	return strings.Join(list, ","), nil
+}
+
+func quoteColumn(column string) (string, error) {
+	if quoted, err := QuoteIdentifier(column); err == nil {
+		return quoted, nil
+	}
+
+	match := aggregatePattern.FindStringSubmatch(column)
+	if match == nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidExpression, column)
+	}
+
+	quoted, err := QuoteIdentifier(match[3])
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidExpression, column)
+	}
+
+	distinct := ""
+	if match[2] != "" {
+		distinct = "DISTINCT "
+	}
+	return strings.ToUpper(match[1]) + "(" + distinct + quoted + ")", nil
+}
+
+// quoteOrders 用于Order，每项为标识符，可带ASC或DESC，其他表达式需使用OrderRaw
+func quoteOrders(orders []string) (string, error) {
+	list := make([]string, 0, len(orders))
+	for _, order := range splitList(orders) {
+		direction := ""
+		if match := orderPattern.FindStringSubmatch(order); match != nil {
+			order, direction = match[1], " "+strings.ToUpper(match[2])
+		}
+
+		quoted, err := QuoteIdentifier(order)
+		if err != nil || quoted == "*" || strings.HasSuffix(quoted, ".*") {
+			return "", identifierError(order)
+		}
+		list = append(list, quoted+direction)
+	}
+	return strings.Join(list, ","), nil
+}
+
+// quoteFields 用于Group，每项为标识符，其他表达式需使用GroupRaw
+func quoteFields(fields []string) (string, error) {
+	list := make([]string, 0, len(fields))
+	for _, field := range splitList(fields) {
+		quoted, err := QuoteIdentifier(field)
+		if err != nil || quoted == "*" || strings.HasSuffix(quoted, ".*") {
+			return "", identifierError(field)
+		}
+		list = append(list, quoted)
+	}
+	return strings.Join(list, ","), nil
+}
+
+// quoteNames 用于Insert及Upsert的字段，每项为不含"*"的标识符
+func quoteNames(names []string) ([]string, error) {
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted, err := QuoteIdentifier(name)
+		if err != nil || quoted == "*" || strings.HasSuffix(quoted, ".*") {
+			return nil, identifierError(name)
+		}
+		list = append(list, quoted)
+	}
+	return list, nil
+}
+
+// splitList 兼容单项中以逗号分隔的写法，括号及反引号中的逗号不拆分
+func splitList(items []string) []string {
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		var (
+			depth  int
+			quoted bool
+			start  int
+		)
+
+		for index := 0; index < len(item); index++ {
+			switch item[index] {
+			case '`':
+				quoted = !quoted
+			case '(':
+				if !quoted {
+					depth++
+				}
+			case ')':
+				if !quoted {
+					depth--
+				}
+			case ',':
+				if !quoted && depth == 0 {
+					list = append(list, strings.TrimSpace(item[start:index]))
+					start = index + 1
+				}
+			}
+		}
+		list = append(list, strings.TrimSpace(item[start:]))
+	}
+	return list
+}
@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldMeta 带bdb标签的字段
+type fieldMeta struct {
+	index     int
+	column    string
+	quoted    string
+	required  bool
+	primary   bool
+	version   bool
+	createdAt bool
+	updatedAt bool
+	deletedAt bool
+	json      bool
+}
+
+// modelMeta 结构体的映射信息，按类型缓存
+type modelMeta struct {
+	//未定义TableName方法时的表名
+	table string
+	//指针类型上TableName方法的下标，未定义时为-1
+	tableIndex int
+	fields     []*fieldMeta
+	columns    map[string]*fieldMeta
+	primaries  []*fieldMeta
+	version    *fieldMeta
+	deleted    *fieldMeta
+	timestamp  bool
+}
+
+var modelCache sync.Map
+
+func getModelMeta(t reflect.Type) *modelMeta {
+	if meta, exists := modelCache.Load(t); exists {
+		return meta.(*modelMeta)
+	}
+
+	meta, _ := modelCache.LoadOrStore(t, parseModelMeta(t))
+	return meta.(*modelMeta)
+}
+
+func parseModelMeta(t reflect.Type) *modelMeta {
+	meta := &modelMeta{
+		table:      strings.ToLower(t.Name()),
+		tableIndex: -1,
+		fields:     make([]*fieldMeta, 0, t.NumField()),
+		columns:    make(map[string]*fieldMeta, t.NumField()),
+	}
+
+	//使用指针类型以同时查找值接收者和指针接收者的方法，只缓存方法下标，表名可能依赖字段值(如分表)，不缓存
+	if method, exists := reflect.PtrTo(t).MethodByName(tableMethod); exists {
+		meta.tableIndex = method.Index
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get(tagName)
+		if tag == "" {
+			continue
+		}
+
+		field := parseTag(tag)
+		field.index = i
+
+		meta.fields = append(meta.fields, field)
+		meta.columns[field.column] = field
+
+		if field.primary {
+			meta.primaries = append(meta.primaries, field)
+		}
+
+		if field.version && meta.version == nil {
+			meta.version = field
+		}
+
+		if field.deletedAt && meta.deleted == nil {
+			meta.deleted = field
+		}
+
+		if field.createdAt || field.updatedAt {
+			meta.timestamp = true
+		}
+	}
+
+	return meta
+}
+
+// tableName 定义了TableName方法时使用value调用，value为结构体或其指针
+func (m *modelMeta) tableName(value reflect.Value) string {
+	if m.tableIndex < 0 {
+		return m.table
+	}
+
+	if value.Kind() != reflect.Ptr {
+		if value.CanAddr() {
+			value = value.Addr()
+		} else {
+			ptr := reflect.New(value.Type())
+			ptr.Elem().Set(value)
+			value = ptr
+		}
+	}
+	return value.Method(m.tableIndex).Call(nil)[0].String()
+}
+
+// quotedTable 校验并以反引号引用表名，支持"db.table"
+func (m *modelMeta) quotedTable(value reflect.Value) (string, error) {
+	return QuoteIdentifier(m.tableName(value))
+}
+
+// parseTag 第一项为字段名，其余为选项
+func parseTag(tag string) *fieldMeta {
+	tags := strings.Split(tag, ",")
+	field := &fieldMeta{
+		column: tags[0],
+		quoted: "`" + tags[0] + "`",
+	}
+
+	for _, val := range tags[1:] {
+		switch strings.TrimSpace(val) {
+		case required:
+			field.required = true
+		case primary:
+			field.primary = true
+		case version:
+			field.version = true
+		case createdAt:
+			field.createdAt = true
+		case updatedAt:
+			field.updatedAt = true
+		case deletedAt:
+			field.deletedAt = true
+		case jsonField:
+			field.json = true
+		}
+	}
+
+	return field
+}
@@ -0,0 +1,427 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMigrateTable       = "schema_migrations"
+	defaultMigrateLockTimeout = 10
+)
+
+var (
+	ErrMigrateLocked        = errors.New("mysql migrate: failed to acquire migration lock")
+	ErrMigrateVersionExists = errors.New("mysql migrate: duplicate migration version")
+	ErrMigrateNoDown        = errors.New("mysql migrate: migration has no down step")
+	ErrMigrateUnknown       = errors.New("mysql migrate: unknown migration version")
+	ErrMigrateDelimiter     = errors.New("mysql migrate: invalid DELIMITER")
+)
+
+var delimiterPattern = regexp.MustCompile(`(?i)^DELIMITER[ \t]+(\S+)[ \t]*(?:\r?\n|$)`)
+
+type MigrateOption struct {
+	//记录已执行版本的表，默认为schema_migrations
+	Table string `yaml:"table" json:"table"`
+	//GET_LOCK锁名，默认为"migrate:"+Table
+	LockName string `yaml:"lockName" json:"lockName"`
+	//单位s，获取锁的超时时间，默认为10
+	LockTimeout int `yaml:"lockTimeout" json:"lockTimeout"`
+}
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      TransactHandler
+	Down    TransactHandler
+}
+
+// Migrator 每个迁移在单独的事务中执行并写入版本记录。MySQL中DDL会隐式提交，
+// 包含DDL的迁移失败时已执行的语句不会回滚且不写入版本记录，错误中包含失败语句的序号，
+// 建议每个迁移只包含一条DDL或使语句可重复执行(如IF NOT EXISTS)
+type Migrator struct {
+	pool       *Pool
+	option     MigrateOption
+	migrations map[int64]*Migration
+}
+
+func NewMigrator(pool *Pool, option *MigrateOption) *Migrator {
+	m := &Migrator{
+		pool:       pool,
+		migrations: make(map[int64]*Migration),
+	}
+
+	if option != nil {
+		m.option = *option
+	}
+
+	if m.option.Table == "" {
+		m.option.Table = defaultMigrateTable
+	}
+
+	if m.option.LockName == "" {
+		m.option.LockName = "migrate:" + m.option.Table
+	}
+
+	if m.option.LockTimeout < 1 {
+		m.option.LockTimeout = defaultMigrateLockTimeout
+	}
+
+	return m
+}
+
+func (m *Migrator) Register(version int64, name string, up TransactHandler, down TransactHandler) error {
+	if _, exists := m.migrations[version]; exists {
+		return fmt.Errorf("%w: %d", ErrMigrateVersionExists, version)
+	}
+
+	m.migrations[version] = &Migration{
+		Version: version,
+		Name:    name,
+		Up:      up,
+		Down:    down,
+	}
+	return nil
+}
+
+func (m *Migrator) RegisterSql(version int64, name string, up string, down string) error {
+	var downHandler TransactHandler
+	if strings.TrimSpace(down) != "" {
+		downHandler = sqlHandler(down)
+	}
+	return m.Register(version, name, sqlHandler(up), downHandler)
+}
+
+// LoadDir 加载目录下的{version}_{name}.up.sql和{version}_{name}.down.sql文件
+func (m *Migrator) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return err
+	}
+
+	for _, upFile := range files {
+		base := strings.TrimSuffix(filepath.Base(upFile), ".up.sql")
+		position := strings.Index(base, "_")
+		if position < 1 {
+			return fmt.Errorf("mysql migrate: invalid migration file name %s", upFile)
+		}
+
+		version, err := strconv.ParseInt(base[:position], 10, 64)
+		if err != nil {
+			return fmt.Errorf("mysql migrate: invalid migration file name %s", upFile)
+		}
+
+		up, err := ioutil.ReadFile(upFile)
+		if err != nil {
+			return err
+		}
+
+		down, err := ioutil.ReadFile(strings.TrimSuffix(upFile, ".up.sql") + ".down.sql")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err = m.RegisterSql(version, base[position+1:], string(up), string(down)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) Migrations() []*Migration {
+	list := make([]*Migration, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		list = append(list, migration)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
+
+// Up 执行所有未执行的迁移
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		for _, migration := range m.Migrations() {
+			if applied[migration.Version] {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// To 迁移到指定版本，高于该版本的已执行迁移会被回滚
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if _, exists := m.migrations[version]; !exists && version != 0 {
+		return fmt.Errorf("%w: %d", ErrMigrateUnknown, version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		list := m.Migrations()
+		for index := len(list) - 1; index >= 0; index-- {
+			if list[index].Version <= version || !applied[list[index].Version] {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, list[index], false); err != nil {
+				return err
+			}
+		}
+
+		for _, migration := range list {
+			if migration.Version > version || applied[migration.Version] {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback 按版本倒序回滚最近执行的steps个迁移
+func (m *Migrator) Rollback(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn, applied map[int64]bool) error {
+		list := m.Migrations()
+		for index := len(list) - 1; index >= 0 && steps > 0; index-- {
+			if !applied[list[index].Version] {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, list[index], false); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Applied 已执行的版本，按升序排列
+func (m *Migrator) Applied(ctx context.Context) (versions []int64, err error) {
+	conn, err := m.pool.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = m.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for version, _ := range applied {
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions, nil
+}
+
+func (m *Migrator) withLock(ctx context.Context, handler func(conn *sql.Conn, applied map[int64]bool) error) (err error) {
+	//GET_LOCK与RELEASE_LOCK须在同一连接上执行
+	conn, err := m.pool.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.option.LockName, m.option.LockTimeout).Scan(&locked)
+	if err != nil {
+		return err
+	}
+
+	if !locked.Valid || locked.Int64 != 1 {
+		return ErrMigrateLocked
+	}
+
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", m.option.LockName)
+	}()
+
+	if err = m.createTable(ctx, conn); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return handler(conn, applied)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `"+m.option.Table+"` ("+
+		"`version` bigint NOT NULL,"+
+		"`name` varchar(255) NOT NULL DEFAULT '',"+
+		"`applied_at` int(10) unsigned NOT NULL DEFAULT '0',"+
+		"PRIMARY KEY (`version`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (applied map[int64]bool, err error) {
+	rows, err := conn.QueryContext(ctx, "SELECT `version` FROM `"+m.option.Table+"`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied = make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration, up bool) (err error) {
+	handler := migration.Up
+	if !up {
+		handler = migration.Down
+		if handler == nil {
+			return fmt.Errorf("%w: %d", ErrMigrateNoDown, migration.Version)
+		}
+	}
+
+	sqlTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	//不使用连接池的语句缓存及拦截器
+	tx := newTx(sqlTx, &Pool{db: m.pool.db, name: m.pool.name, dialect: m.pool.dialect})
+	if err = runTransactHandler(tx, handler); err == nil {
+		if up {
+			_, err = tx.ExecuteContext(ctx, "INSERT INTO `"+m.option.Table+"`(`version`,`name`,`applied_at`)VALUES(?,?,?)", migration.Version, migration.Name, time.Now().Unix())
+		} else {
+			_, err = tx.ExecuteContext(ctx, "DELETE FROM `"+m.option.Table+"` WHERE `version` = ?", migration.Version)
+		}
+	}
+
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("mysql migrate: version %d %s: %w", migration.Version, migration.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+func sqlHandler(content string) TransactHandler {
+	statements, err := splitStatements(content)
+	return func(tx *Transaction) error {
+		if err != nil {
+			return err
+		}
+
+		for index, statement := range statements {
+			if _, err := tx.Execute(statement); err != nil {
+				return fmt.Errorf("statement %d/%d: %w", index+1, len(statements), err)
+			}
+		}
+		return nil
+	}
+}
+
+// splitStatements 按分号拆分sql，忽略引号内及注释中的分号，支持以DELIMITER行切换分隔符(用于触发器及存储过程)
+func splitStatements(content string) (statements []string, err error) {
+	var (
+		buf       strings.Builder
+		quote     byte
+		delimiter = ";"
+	)
+
+	appendStatement := func() {
+		if statement := strings.TrimSpace(buf.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		buf.Reset()
+	}
+
+	for index := 0; index < len(content); index++ {
+		ch := content[index]
+
+		if quote != 0 {
+			buf.WriteByte(ch)
+			if ch == '\\' && index+1 < len(content) {
+				index++
+				buf.WriteByte(content[index])
+			} else if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		//DELIMITER须单独成行，且位于语句开始处
+		if (index == 0 || content[index-1] == '\n') && strings.TrimSpace(buf.String()) == "" {
+			line := strings.TrimLeft(content[index:], " \t")
+			if len(line) >= len("DELIMITER") && strings.EqualFold(line[:len("DELIMITER")], "DELIMITER") {
+				match := delimiterPattern.FindStringSubmatch(line)
+				if match == nil || strings.ContainsAny(match[1], "'\"`") {
+					return nil, fmt.Errorf("%w: %q", ErrMigrateDelimiter, strings.SplitN(line, "\n", 2)[0])
+				}
+
+				delimiter = match[1]
+				index += len(content[index:]) - len(line) + len(match[0]) - 1
+				continue
+			}
+		}
+
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			buf.WriteByte(ch)
+		case ch == '#' || (ch == '-' && strings.HasPrefix(content[index:], "-- ")):
+			for index < len(content) && content[index] != '\n' {
+				index++
+			}
+			buf.WriteByte('\n')
+		case ch == '/' && strings.HasPrefix(content[index:], "/*"):
+			end := strings.Index(content[index+2:], "*/")
+			if end < 0 {
+				index = len(content)
+			} else {
+				index += end + 3
+			}
+			buf.WriteByte(' ')
+		case strings.HasPrefix(content[index:], delimiter):
+			appendStatement()
+			index += len(delimiter) - 1
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+
+	appendStatement()
+	return statements, nil
+}
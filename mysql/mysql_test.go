@@ -1,12 +1,26 @@
 package mysql
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	mysqlDriver "github.com/go-sql-driver/mysql"
 	"github.com/grpc-boot/boot"
 )
 
@@ -164,6 +178,20 @@ func TestGroup_DeleteAll(t *testing.T) {
 	fmt.Println("group:DeleteAll affactedRows:", result.AffectedRows)
 }
 
+func TestGroup_InsertContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := group.InsertContext(ctx, "`user`", map[string]interface{}{
+		"`nickname`":   "canceled",
+		"`created_at`": time.Now().Unix(),
+	})
+
+	if err != context.Canceled {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+}
+
 func TestGroup_SlaveQuery(t *testing.T) {
 	query := AcquireQuery()
 	defer ReleaseQuery(query)
@@ -219,6 +247,27 @@ func TestGroup_FindOne(t *testing.T) {
 	t.Log(user)
 }
 
+func TestGroup_FindAll(t *testing.T) {
+	query := AcquireQuery()
+	defer ReleaseQuery(query)
+
+	query.From("`user`").
+		Order("`id` DESC").
+		Limit(0, 10)
+
+	var userList []*User
+	err := group.FindAll(query, &userList, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range userList {
+		if user.Id < 1 {
+			t.Fatal("want >1 got <1")
+		}
+	}
+}
+
 func TestGroup_MasterQuery(t *testing.T) {
 	query := AcquireQuery()
 	defer ReleaseQuery(query)
@@ -362,3 +411,1508 @@ func TestGroupTransaction(t *testing.T) {
 	}
 	t.Fatal(group.GetBadPool(true), group.GetBadPool(false))
 }
+
+func TestQuery_WhereCondition(t *testing.T) {
+	query := AcquireQuery()
+	defer ReleaseQuery(query)
+
+	query.From("`user`").
+		WhereCondition(
+			Or(Eq("`id`", 1), In("`nickname`", "a", "b")),
+			Not(IsNull("`created_at`")),
+			NotBetween("`created_at`", 1, 10),
+			NotIn("`id`", 7, 8),
+			Raw("`nickname` <> ''"),
+		).
+		Limit(0, 10)
+
+	sql, args, _ := buildQuery(query)
+	want := "SELECT * FROM `user` WHERE ((`id` = ? OR `nickname` IN(?,?)) AND NOT (`created_at` IS NULL) AND `created_at` NOT BETWEEN ? AND ? AND `id` NOT IN(?,?) AND (`nickname` <> '')) LIMIT 0,10"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	if len(args) != 7 || args[0] != 1 || args[1] != "a" || args[6] != 8 {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	query.Where(map[string]interface{}{
+		"`nickname`":      "u",
+		"`created_at` >":  1,
+		"`id` NOT IN":     []interface{}{1, 2},
+		"`created_at` <=": 10,
+	})
+
+	sql, args, _ = buildQuery(query)
+	want = "SELECT * FROM `user` WHERE (`created_at` <= ? AND `created_at` > ? AND `id` NOT IN(?,?) AND `nickname` = ?) LIMIT 0,10"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	if len(args) != 5 || args[0] != 10 || args[4] != "u" {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	//Raw中的OR不能改变外层AND的逻辑
+	query.WhereCondition(Eq("a", 1), Raw("b = ? OR c = ?", 2, 3))
+	sql, args, _ = buildQuery(query)
+	want = "SELECT * FROM `user` WHERE (`a` = ? AND (b = ? OR c = ?)) LIMIT 0,10"
+	if sql != want || len(args) != 3 {
+		t.Fatalf("want %s, got %s %v", want, sql, args)
+	}
+}
+
+func TestQuery_Join(t *testing.T) {
+	orders := AcquireQuery()
+	defer ReleaseQuery(orders)
+	orders.Select("`user_id`").
+		From("`order`").
+		Where(map[string]interface{}{
+			"`amount` >": 100,
+		})
+
+	query := AcquireQuery()
+	defer ReleaseQuery(query)
+	query.Select("u.`id`", "o.`amount`").
+		From("`user`").
+		Alias("u").
+		LeftJoin("`order`", "o", On("u.`id`", "o.`user_id`")).
+		WhereCondition(InQuery("u.`id`", orders), Gt("u.`created_at`", 0)).
+		Limit(0, 10)
+
+	sql, args, _ := buildQuery(query)
+	want := "SELECT `u`.`id`,`o`.`amount` FROM `user` AS u LEFT JOIN `order` AS o ON `u`.`id` = `o`.`user_id` WHERE (`u`.`id` IN (SELECT `user_id` FROM `order` WHERE `amount` > ?) AND `u`.`created_at` > ?) LIMIT 0,10"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	if len(args) != 2 || args[0] != 100 || args[1] != 0 {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	derived := AcquireQuery()
+	defer ReleaseQuery(derived)
+	derived.Select("COUNT(*) AS total").
+		FromQuery(orders, "t").
+		WhereCondition(Exists(orders))
+
+	sql, args, _ = buildQuery(derived)
+	want = "SELECT COUNT(*) AS `total` FROM (SELECT `user_id` FROM `order` WHERE `amount` > ?) AS t WHERE EXISTS (SELECT `user_id` FROM `order` WHERE `amount` > ?) LIMIT 0,1000"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	//显式设置的LIMIT保留
+	orders.Limit(0, 5)
+	sql, _, _ = buildQuery(AcquireQuery().FromQuery(orders, "t"))
+	want = "SELECT * FROM (SELECT `user_id` FROM `order` WHERE `amount` > ? LIMIT 0,5) AS t LIMIT 0,1000"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	if len(args) != 2 {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestBuildUpsert(t *testing.T) {
+	sql, args, err := buildUpsert(MysqlDialect{}, "`user`", nil, []string{"`nickname`"}, map[string]interface{}{
+		"`id`":       1,
+		"`nickname`": "u1",
+	}, map[string]interface{}{
+		"`id`":       2,
+		"`nickname`": "u2",
+	})
+
+	want := "INSERT INTO `user`(`id`,`nickname`)VALUES(?,?),(?,?) ON DUPLICATE KEY UPDATE `nickname`=VALUES(`nickname`)"
+	if err != nil || sql != want || len(args) != 4 {
+		t.Fatalf("want %s, got %s %v", want, sql, args)
+	}
+
+	//默认更新字段不包含冲突检测字段
+	sql, _, err = buildUpsert(PostgresDialect{}, "`user`", []string{"id"}, nil, map[string]interface{}{"id": 1, "nickname": "u1"})
+	want = "INSERT INTO `user`(`id`,`nickname`)VALUES(?,?) ON CONFLICT(`id`) DO UPDATE SET `nickname`=EXCLUDED.`nickname`"
+	if err != nil || sql != want {
+		t.Fatalf("want %s, got %s %v", want, sql, err)
+	}
+
+	sql, _, err = buildUpsert(MysqlDialect{}, "`user`", []string{"`id`"}, nil, map[string]interface{}{"id": 1, "nickname": "u1"})
+	want = "INSERT INTO `user`(`id`,`nickname`)VALUES(?,?) ON DUPLICATE KEY UPDATE `nickname`=VALUES(`nickname`)"
+	if err != nil || sql != want {
+		t.Fatalf("want %s, got %s %v", want, sql, err)
+	}
+
+	sql, _, _ = buildReplaceByMap("`user`", map[string]interface{}{"id": 1})
+	if sql != "REPLACE INTO `user`(`id`)VALUES(?)" {
+		t.Fatalf("unexpected sql %s", sql)
+	}
+
+	sql, args, err = BuildUpsertByObj(User{Id: 1, NickName: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = "INSERT INTO `user`(`id`,`nickname`,`created_at`)VALUES(?,?,?) ON DUPLICATE KEY UPDATE `nickname`=VALUES(`nickname`),`created_at`=VALUES(`created_at`)"
+	if sql != want || len(args) != 3 {
+		t.Fatalf("want %s, got %s %v", want, sql, args)
+	}
+}
+
+func TestQuery_Identifier(t *testing.T) {
+	query := AcquireQuery().From("`user`").
+		Select("id", "u.nickname AS name", "count(DISTINCT `id`) total").
+		Where(map[string]interface{}{"created_at >=": 1, "id not in": []interface{}{1, 2}}).
+		Group("id, nickname").
+		Order("created_at desc", "`id`")
+	defer ReleaseQuery(query)
+
+	sql, _, err := query.Build()
+	if err == nil {
+		t.Fatalf("want error for alias without AS, got %s", sql)
+	}
+
+	query.reset()
+	query.From("`user`").
+		Select("id", "u.nickname AS name", "count(DISTINCT `id`) AS total").
+		Where(map[string]interface{}{"created_at >=": 1, "id not in": []interface{}{1, 2}}).
+		Group("id, nickname").
+		Order("created_at desc", "`id`")
+
+	sql, args, err := query.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "SELECT `id`,`u`.`nickname` AS `name`,COUNT(DISTINCT `id`) AS `total` FROM `user` WHERE (`created_at` >= ? AND `id` NOT IN(?,?)) GROUP BY `id`,`nickname` ORDER BY `created_at` DESC,`id` LIMIT 0,1000"
+	if sql != want || len(args) != 3 {
+		t.Fatalf("want %s, got %s %v", want, sql, args)
+	}
+
+	cases := []struct {
+		query *Query
+		err   error
+	}{
+		{AcquireQuery().From("user").Order("id; DROP TABLE user"), ErrInvalidIdentifier},
+		{AcquireQuery().From("user").Order("(SELECT 1)"), ErrInvalidIdentifier},
+		{AcquireQuery().From("user").Group("id DESC"), ErrInvalidIdentifier},
+		{AcquireQuery().From("user").Select("SLEEP(5)"), ErrInvalidExpression},
+		{AcquireQuery().From("user").Select("id FROM secret"), ErrInvalidExpression},
+		{AcquireQuery().From("user").Where(map[string]interface{}{"id OR 1=1 --": 1}), ErrInvalidOperator},
+		{AcquireQuery().From("user").Where(map[string]interface{}{"id=1": 1}), ErrInvalidIdentifier},
+		{AcquireQuery().From("user").WhereCondition(Not(Or(Eq("id", 1), Compare("id", "REGEXP", "a")))), ErrInvalidOperator},
+		{AcquireQuery().From("user").WhereCondition(InQuery("id", AcquireQuery().From("order").Select("user_id`"))), ErrInvalidExpression},
+		{AcquireQuery().From("user").LeftJoin("order", "o", On("id", "o.user_id OR 1")), ErrInvalidIdentifier},
+		{AcquireQuery().From("user").Where(map[string]interface{}{"deleted_at is": 1}), ErrInvalidOperator},
+		{AcquireQuery().From("user").WhereCondition(Compare("deleted_at", "IS", nil)), ErrInvalidOperator},
+	}
+
+	for index, c := range cases {
+		if _, _, err := c.query.Build(); !errors.Is(err, c.err) {
+			t.Fatalf("case %d want %v, got %v", index, c.err, err)
+		}
+	}
+
+	query.reset()
+	sql, _, err = query.From("`user`").SelectRaw("DATE(`created_at`) AS day", "COUNT(*) AS total").GroupRaw("DATE(`created_at`)").OrderRaw("FIELD(`day`, 2, 1)", "`total` DESC").Build()
+	want = "SELECT DATE(`created_at`) AS day,COUNT(*) AS total FROM `user` GROUP BY DATE(`created_at`) ORDER BY FIELD(`day`, 2, 1),`total` DESC LIMIT 0,1000"
+	if err != nil || sql != want {
+		t.Fatalf("want %s, got %s %v", want, sql, err)
+	}
+
+	query.reset()
+	sql, args, err = query.From("`user`").Where(map[string]interface{}{"deleted_at is": nil, "name IS  not": nil}).Build()
+	want = "SELECT * FROM `user` WHERE (`deleted_at` IS NULL AND `name` IS NOT NULL) LIMIT 0,1000"
+	if err != nil || sql != want || len(args) != 0 {
+		t.Fatalf("want %s, got %s %v", want, sql, err)
+	}
+
+	if _, _, err = buildUpdateAll("`user`", map[string]interface{}{"a=1,b": 1}, nil); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatalf("want ErrInvalidIdentifier, got %v", err)
+	}
+
+	if _, _, err = buildDeleteAll("`user`", map[string]interface{}{"id or": 1}); !errors.Is(err, ErrInvalidOperator) {
+		t.Fatalf("want ErrInvalidOperator, got %v", err)
+	}
+
+	if _, _, err = buildInsertByMap("`user`", map[string]interface{}{"a) VALUES (1); DROP TABLE t; --": 1}); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatalf("want ErrInvalidIdentifier, got %v", err)
+	}
+
+	if _, _, err = buildUpsert(MysqlDialect{}, "`user`", nil, []string{"x=1, evil"}, map[string]interface{}{"id": 1}); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatalf("want ErrInvalidIdentifier, got %v", err)
+	}
+
+	if _, _, err = BuildUpsertByObj(User{Id: 1}, "x=1, evil"); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatalf("want ErrInvalidIdentifier, got %v", err)
+	}
+
+	sql, args, err = buildUpsert(MysqlDialect{}, "`user`", nil, []string{"nickname"}, map[string]interface{}{"id": 1, "nickname": "u1"})
+	want = "INSERT INTO `user`(`id`,`nickname`)VALUES(?,?) ON DUPLICATE KEY UPDATE `nickname`=VALUES(`nickname`)"
+	if err != nil || sql != want || len(args) != 2 {
+		t.Fatalf("want %s, got %s %v", want, sql, err)
+	}
+}
+
+func TestDialect(t *testing.T) {
+	if _, err := NewDialect("oracle"); err != ErrUnknownDialect {
+		t.Fatalf("want ErrUnknownDialect, got %v", err)
+	}
+
+	query := AcquireQuery().From("`user`").WhereCondition(And(Eq("`name`", "a`?"), Gt("`id`", 1))).Limit(20, 10)
+	defer ReleaseQuery(query)
+
+	sqlStr, args, _ := buildQuery(query)
+	if len(args) != 2 {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	d, _ := NewDialect("postgresql")
+	want := `SELECT * FROM "user" WHERE ("name" = $1 AND "id" > $2) LIMIT 10 OFFSET 20`
+	if got := d.Rebind(sqlStr); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	d, _ = NewDialect("sqlite3")
+	want = `SELECT * FROM "user" WHERE ("name" = ? AND "id" > ?) LIMIT 10 OFFSET 20`
+	if got := d.Rebind(sqlStr); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	//字符串字面量中的内容不转换
+	got := PostgresDialect{}.Rebind("SELECT '`a`?', 'it''s ?' FROM `t` WHERE `b`=? LIMIT 1")
+	want = `SELECT '` + "`a`" + `?', 'it''s ?' FROM "t" WHERE "b"=$1 LIMIT 1`
+	if got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	//双引号为标识符，其中的?及反斜杠不做处理
+	got = PostgresDialect{}.Rebind("SELECT \"a?b\\\", `c?``d\"` FROM `t` WHERE `b`=?")
+	want = `SELECT "a?b\", "c?` + "`" + `d""" FROM "t" WHERE "b"=$1`
+	if got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	sqlStr, _, err := buildUpsertByObj(PostgresDialect{}, User{Id: 1, NickName: "u1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = "INSERT INTO `user`(`id`,`nickname`,`created_at`)VALUES(?,?,?) ON CONFLICT(`id`) DO UPDATE SET `nickname`=EXCLUDED.`nickname`,`created_at`=EXCLUDED.`created_at`"
+	if sqlStr != want {
+		t.Fatalf("want %s, got %s", want, sqlStr)
+	}
+
+	pool, err := NewPool(&PoolOption{Dsn: "root:123456@tcp(127.0.0.1:3306)/test", Dialect: "postgres", Driver: "mysql", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.Name() != DialectPostgres {
+		t.Fatalf("unexpected name %s", pool.Name())
+	}
+
+	//未指定冲突字段时PostgreSQL不支持DO UPDATE，REPLACE INTO也不支持
+	if _, err = pool.Upsert("`user`", map[string]interface{}{"`id`": 1}); err != ErrUnsupportedDialect {
+		t.Fatalf("want ErrUnsupportedDialect, got %v", err)
+	}
+
+	if _, err = pool.Replace("`user`", map[string]interface{}{"`id`": 1}); err != ErrUnsupportedDialect {
+		t.Fatalf("want ErrUnsupportedDialect, got %v", err)
+	}
+
+	if _, err = pool.ReplaceObj(User{Id: 1}); err != ErrUnsupportedDialect {
+		t.Fatalf("want ErrUnsupportedDialect, got %v", err)
+	}
+
+	if statements := pool.Statements(); len(statements) != 0 {
+		t.Fatalf("unexpected statements %v", statements)
+	}
+
+	rows := []map[string]interface{}{{"id": 1, "name": "a"}}
+	if _, err = pool.UpsertWithOption(context.Background(), "user", rows, &UpsertOption{Keys: []string{"id"}, UpdateColumns: []string{"name"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want = `INSERT INTO user("id","name")VALUES($1,$2) ON CONFLICT("id") DO UPDATE SET "name"=EXCLUDED."name"`
+	if statements := pool.Statements(); len(statements) != 1 || statements[0].Sql != want {
+		t.Fatalf("want %s, got %v", want, statements)
+	}
+
+	pool, _ = NewPool(&PoolOption{Dsn: "root:123456@tcp(127.0.0.1:3306)/test", Dialect: "sqlite", Driver: "mysql", DryRun: true})
+	_, _ = pool.Upsert("`user`", map[string]interface{}{"`id`": 1})
+	statements := pool.Statements()
+	if len(statements) != 1 || statements[0].Sql != `INSERT INTO "user"("id")VALUES(?) ON CONFLICT DO UPDATE SET "id"=EXCLUDED."id"` {
+		t.Fatalf("unexpected statements %v", statements)
+	}
+}
+
+func TestShardRouter_Locate(t *testing.T) {
+	groups := []*Group{group, NewGroup(&config.Boot)}
+	router, err := NewShardRouter(&ShardOption{Table: "user", TableCount: 64}, groups, ModStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shard, err := router.Locate(int64(70))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shard.Table != "user_06" || shard.DbIndex != 0 {
+		t.Fatalf("want user_06@0, got %s@%d", shard.Table, shard.DbIndex)
+	}
+
+	shard, _ = router.Locate(63)
+	if shard.Table != "user_63" || shard.Group != groups[1] {
+		t.Fatalf("want user_63@1, got %s@%d", shard.Table, shard.DbIndex)
+	}
+
+	rangeRouter, _ := NewShardRouter(&ShardOption{Table: "order", TableCount: 2, TableFormat: "%s_%d"}, groups, RangeStrategy{Bounds: []int64{1000, 2000}})
+	shard, _ = rangeRouter.Locate(1500)
+	if shard.Table != "order_1" || shard.DbIndex != 1 {
+		t.Fatalf("want order_1@1, got %s@%d", shard.Table, shard.DbIndex)
+	}
+
+	if _, err = rangeRouter.Locate(2000); err != ErrShardKeyOutOfRange {
+		t.Fatalf("want ErrShardKeyOutOfRange, got %v", err)
+	}
+
+	ringRouter, _ := NewShardRouter(&ShardOption{Table: "user", TableCount: 64}, groups, NewRingStrategy(64))
+	first, _ := ringRouter.Locate("nickname")
+	second, _ := ringRouter.Locate("nickname")
+	if first.Table != second.Table {
+		t.Fatalf("want same table, got %s and %s", first.Table, second.Table)
+	}
+}
+
+func TestGroup_StickToMaster(t *testing.T) {
+	option := config.Boot
+	option.StickyInterval = 100
+	g := NewGroup(&option)
+
+	session := NewSession()
+	ctx := WithSession(context.Background(), session)
+	if g.stickToMaster(ctx, false) {
+		t.Fatal("want false, got true")
+	}
+
+	g.markWrite(ctx)
+	if !g.stickToMaster(ctx, false) {
+		t.Fatal("want true, got false")
+	}
+
+	if group.stickToMaster(ctx, false) {
+		t.Fatal("want false when stickyInterval is 0, got true")
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	if g.stickToMaster(ctx, false) {
+		t.Fatal("want false, got true")
+	}
+}
+
+func TestBalancer_Select(t *testing.T) {
+	light, _ := NewPool(&PoolOption{Dsn: config.Boot.Masters[0].Dsn, Weight: 1})
+	heavy, _ := NewPool(&PoolOption{Dsn: config.Boot.Masters[0].Dsn, Weight: 3})
+	pools := []*Pool{light, heavy}
+
+	counts := make([]int, 2)
+	weighted, _ := NewBalancer(BalancerWeighted)
+	for i := 0; i < 4000; i++ {
+		counts[weighted.Select(pools)]++
+	}
+
+	if counts[1] < 2*counts[0] {
+		t.Fatalf("want about 1:3, got %v", counts)
+	}
+
+	roundRobin, _ := NewBalancer(BalancerRoundRobin)
+	if roundRobin.Select(pools) == roundRobin.Select(pools) {
+		t.Fatal("want alternate pools, got same pool")
+	}
+
+	light.observe(10 * time.Millisecond)
+	heavy.observe(time.Millisecond)
+	leastLatency, _ := NewBalancer(BalancerLeastLatency)
+	if leastLatency.Select(pools) != 1 {
+		t.Fatal("want 1, got 0")
+	}
+
+	if _, err := NewBalancer("random"); err != ErrUnknownBalancer {
+		t.Fatalf("want ErrUnknownBalancer, got %v", err)
+	}
+}
+
+func TestGroup_BadPoolDetail(t *testing.T) {
+	g := NewGroup(&config.Boot)
+
+	var events []bool
+	g.OnStateChange(func(index int, isMaster bool, isDown bool, reason error) {
+		events = append(events, isDown)
+	})
+
+	reason := errors.New("connection refused")
+	g.down(1, true, reason)
+	g.down(1, true, reason)
+
+	list := g.GetBadPoolDetail(true)
+	if len(list) != 1 || list[0].Index != 1 || list[0].Reason != reason || list[0].DownAt.IsZero() {
+		t.Fatalf("unexpected bad pool detail %+v", list)
+	}
+
+	g.up(1, true)
+	if len(g.GetBadPool(true)) != 0 {
+		t.Fatalf("want no bad pool, got %v", g.GetBadPool(true))
+	}
+
+	if len(events) != 2 || !events[0] || events[1] {
+		t.Fatalf("want [true false], got %v", events)
+	}
+}
+
+func TestGroup_BadStateHandler(t *testing.T) {
+	g := NewGroup(&config.Boot)
+
+	var (
+		wg    sync.WaitGroup
+		count int64
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			g.down(0, true, errors.New("connection refused"))
+			g.up(0, true)
+		}
+	}()
+
+	//健康检查启动后设置回调不应产生数据竞争
+	g.OnStateChange(func(index int, isMaster bool, isDown bool, reason error) {
+		atomic.AddInt64(&count, 1)
+	})
+	wg.Wait()
+
+	g.down(0, true, errors.New("connection refused"))
+	if atomic.LoadInt64(&count) < 1 {
+		t.Fatal("want state handler called")
+	}
+}
+
+func TestPool_Use(t *testing.T) {
+	pool, err := NewPool(&config.Boot.Masters[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		statements []*Statement
+		buf        = bytes.NewBuffer(nil)
+	)
+
+	pool.Use(AfterFunc(func(ctx context.Context, stmt *Statement) {
+		statements = append(statements, stmt)
+	}), NewSlowQueryLogger(0, true, log.New(buf, "", 0)))
+
+	_, err = pool.Execute("UPDATE `user` SET `nickname`=? WHERE `id`=?", "secret", 1)
+	if len(statements) != 1 || statements[0].Err != err || statements[0].Pool != pool {
+		t.Fatalf("unexpected statements %+v", statements)
+	}
+
+	if statements[0].Sql != "UPDATE `user` SET `nickname`=? WHERE `id`=?" || len(statements[0].Args) != 2 {
+		t.Fatalf("unexpected statement %+v", statements[0])
+	}
+
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "<string>") {
+		t.Fatalf("want redacted args, got %s", buf.String())
+	}
+
+	if pool.Name() != "127.0.0.1:3306/dd" {
+		t.Fatalf("want 127.0.0.1:3306/dd, got %s", pool.Name())
+	}
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	deadlock := &mysqlDriver.MySQLError{Number: ErrCodeDeadlock, Message: "Deadlock found when trying to get lock"}
+	if !IsRetryableTxError(fmt.Errorf("update user: %w", deadlock)) {
+		t.Fatal("want true, got false")
+	}
+
+	if IsRetryableTxError(&mysqlDriver.MySQLError{Number: 1062}) {
+		t.Fatal("want false, got true")
+	}
+}
+
+func TestGroup_Transact(t *testing.T) {
+	err := group.Transact(context.Background(), func(tx *Transaction) error {
+		_, err := tx.UpdateAll("`user`", map[string]interface{}{
+			"`created_at`": time.Now().Unix(),
+		}, map[string]interface{}{
+			"`id`": 2,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Transact(context.Background(), func(tx *Transaction) error {
+			_, err := tx.Insert("`user`", map[string]interface{}{
+				"`nickname`": "nested",
+			})
+			return err
+		})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransaction_Callbacks(t *testing.T) {
+	var (
+		called []int
+		failed = errors.New("publish failed")
+	)
+
+	err := runCallbacks([]func() error{
+		func() error {
+			called = append(called, 1)
+			return failed
+		},
+		func() error {
+			called = append(called, 2)
+			panic("cache down")
+		},
+		func() error {
+			called = append(called, 3)
+			return nil
+		},
+	})
+
+	callbackErr, ok := err.(*CallbackError)
+	if !ok || len(callbackErr.Errors) != 2 || callbackErr.Errors[0] != failed {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(called) != 3 || called[0] != 1 || called[2] != 3 {
+		t.Fatalf("want [1 2 3], got %v", called)
+	}
+}
+
+func TestMigrator_LoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"0002_add_nickname_index.up.sql":   "ALTER TABLE `user` ADD INDEX `idx_nickname`(`nickname`);",
+		"0001_create_user.up.sql":          "CREATE TABLE `user` (`id` int PRIMARY KEY, `nickname` varchar(32) DEFAULT 'a;b');\n-- seed;\nINSERT INTO `user` VALUES(1, 'u;1');",
+		"0001_create_user.down.sql":        "DROP TABLE `user`;",
+		"0002_add_nickname_index.down.sql": "",
+	}
+
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrator := NewMigrator(group.masters[0], nil)
+	if err = migrator.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	list := migrator.Migrations()
+	if len(list) != 2 || list[0].Version != 1 || list[0].Name != "create_user" || list[1].Down != nil {
+		t.Fatalf("unexpected migrations %+v", list)
+	}
+
+	if err = migrator.LoadDir(dir); !errors.Is(err, ErrMigrateVersionExists) {
+		t.Fatalf("want ErrMigrateVersionExists, got %v", err)
+	}
+
+	statements, err := splitStatements(files["0001_create_user.up.sql"])
+	if err != nil || len(statements) != 2 || statements[1] != "INSERT INTO `user` VALUES(1, 'u;1')" {
+		t.Fatalf("unexpected statements %q %v", statements, err)
+	}
+
+	trigger := "DROP TRIGGER IF EXISTS t_ai;\n" +
+		"DELIMITER $$\n" +
+		"CREATE TRIGGER t_ai AFTER INSERT ON t FOR EACH ROW BEGIN\n" +
+		"  INSERT INTO log VALUES(NEW.id);\n" +
+		"  UPDATE stat SET n = n + 1;\n" +
+		"END$$\n" +
+		"  delimiter ;\n" +
+		"INSERT INTO t VALUES(1);"
+	statements, err = splitStatements(trigger)
+	if err != nil || len(statements) != 3 || !strings.HasSuffix(statements[1], "UPDATE stat SET n = n + 1;\nEND") || statements[2] != "INSERT INTO t VALUES(1)" {
+		t.Fatalf("unexpected statements %q %v", statements, err)
+	}
+
+	if _, err = splitStatements("DELIMITER\nSELECT 1;"); !errors.Is(err, ErrMigrateDelimiter) {
+		t.Fatalf("want ErrMigrateDelimiter, got %v", err)
+	}
+}
+
+func TestGenerateSource(t *testing.T) {
+	source, err := GenerateSource("model", map[string][]Column{
+		"user_profile": {
+			{Name: "id", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+			{Name: "nickname", DataType: "varchar", ColumnType: "varchar(32)", Nullable: true, Comment: "用户名"},
+			{Name: "is_vip", DataType: "tinyint", ColumnType: "tinyint(1)", Default: sql.NullString{String: "0", Valid: true}},
+			{Name: "created_at", DataType: "bigint", ColumnType: "bigint(20)"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"type UserProfile struct {",
+		"Id        uint32  `bdb:\"id,primary\"`",
+		"Nickname  *string `bdb:\"nickname\"` //用户名",
+		"IsVip     bool    `bdb:\"is_vip\"`",
+		"CreatedAt int64   `bdb:\"created_at,required\"`",
+		"func (u UserProfile) TableName() string {",
+	} {
+		if !strings.Contains(string(source), want) {
+			t.Fatalf("want %s in:\n%s", want, source)
+		}
+	}
+}
+
+type Account struct {
+	Id      int64  `bdb:"id,primary"`
+	Balance int64  `bdb:"balance,required"`
+	Remark  string `bdb:"remark"`
+	Version int64  `bdb:"version,version"`
+}
+
+func (a Account) TableName() string {
+	return `account`
+}
+
+func TestBuildUpdateByObj_Version(t *testing.T) {
+	account := &Account{Id: 1, Balance: 100, Version: 3}
+	sql, args, versionField, err := buildUpdateByObj(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "UPDATE `account` SET `balance`=?,`version`=`version`+1 WHERE (`id` = ? AND `version` = ?)"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	if len(args) != 3 || args[0] != int64(100) || args[1] != int64(1) || args[2] != int64(3) {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	incrVersion(versionField)
+	if account.Version != 4 {
+		t.Fatalf("want 4, got %d", account.Version)
+	}
+}
+
+type Article struct {
+	Id        int64     `bdb:"id,primary"`
+	Title     string    `bdb:"title"`
+	CreatedAt int64     `bdb:"created_at,created_at"`
+	UpdatedAt time.Time `bdb:"updated_at,updated_at"`
+	DeletedAt int64     `bdb:"deleted_at,deleted_at"`
+}
+
+func (a Article) TableName() string {
+	return "article"
+}
+
+func TestBuildSoftDelete(t *testing.T) {
+	article := &Article{Id: 1, Title: "boot"}
+	sql, args, err := BuildInsertByObj(article)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "INSERT INTO `article`(`id`,`title`,`created_at`,`updated_at`)VALUES(?,?,?,?)"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	if article.CreatedAt == 0 || article.UpdatedAt.IsZero() || len(args) != 4 {
+		t.Fatalf("timestamps not filled: %+v %v", article, args)
+	}
+
+	sql, _, err = BuildUpdateByObj(article)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = "UPDATE `article` SET `title`=?,`updated_at`=? WHERE `id` = ?"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	article.UpdatedAt = time.Time{}
+	sql, args, err = BuildDeleteByObj(article)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = "UPDATE `article` SET `deleted_at`=?,`updated_at`=? WHERE `id` = ?"
+	if sql != want || article.DeletedAt == 0 || len(args) != 3 || args[0] != article.DeletedAt {
+		t.Fatalf("want %s, got %s %v", want, sql, args)
+	}
+
+	if updatedAt, ok := args[1].(time.Time); !ok || updatedAt.IsZero() || !updatedAt.Equal(article.UpdatedAt) || args[2] != int64(1) {
+		t.Fatalf("want updated_at bound, got %v", args)
+	}
+
+	query := AcquireQuery().Model(&[]Article{}).Where(map[string]interface{}{"title": "boot"})
+	sql, _, _ = buildQuery(query)
+	want = "SELECT * FROM `article` WHERE (`title` = ? AND `deleted_at` = ?) LIMIT 0,1000"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	sql, _, _ = buildQuery(query.WithDeleted())
+	want = "SELECT * FROM `article` WHERE `title` = ? LIMIT 0,1000"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+	ReleaseQuery(query)
+
+	query = AcquireQuery().WhereCondition(Raw("b = ? OR c = ?", 1, 2)).Model(&[]Article{})
+	sql, _, _ = buildQuery(query)
+	want = "SELECT * FROM `article` WHERE ((b = ? OR c = ?) AND `deleted_at` = ?) LIMIT 0,1000"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+	ReleaseQuery(query)
+}
+
+type Profile struct {
+	Id       int64                  `bdb:"id,primary"`
+	Birthday time.Time              `bdb:"birthday"`
+	LoginAt  sql.NullTime           `bdb:"login_at"`
+	Score    sql.NullInt64          `bdb:"score"`
+	Nickname *string                `bdb:"nickname"`
+	Avatar   []byte                 `bdb:"avatar"`
+	Extra    map[string]interface{} `bdb:"extra,json"`
+}
+
+func (p Profile) TableName() string {
+	return "profile"
+}
+
+func TestSetField(t *testing.T) {
+	var (
+		profile Profile
+		value   = reflect.ValueOf(&profile).Elem()
+	)
+
+	columns := []struct {
+		index int
+		value []byte
+		json  bool
+	}{
+		{1, []byte("2021-06-01 12:30:00"), false},
+		{2, []byte("2021-06-01T12:30:00Z"), false},
+		{3, []byte("99"), false},
+		{4, []byte("boot"), false},
+		{5, []byte{0x01, 0x02}, false},
+		{6, []byte(`{"vip":true}`), true},
+	}
+
+	for _, column := range columns {
+		if err := setField(value.Field(column.index), column.value, column.json); err != nil {
+			t.Fatalf("field %d: %s", column.index, err)
+		}
+	}
+
+	if profile.Birthday.Year() != 2021 || profile.Birthday.Minute() != 30 {
+		t.Fatalf("unexpected birthday %v", profile.Birthday)
+	}
+
+	if !profile.LoginAt.Valid || !profile.LoginAt.Time.Equal(profile.Birthday) {
+		t.Fatalf("unexpected login_at %v", profile.LoginAt)
+	}
+
+	if !profile.Score.Valid || profile.Score.Int64 != 99 {
+		t.Fatalf("unexpected score %v", profile.Score)
+	}
+
+	if profile.Nickname == nil || *profile.Nickname != "boot" || !bytes.Equal(profile.Avatar, []byte{0x01, 0x02}) {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+
+	if profile.Extra["vip"] != true {
+		t.Fatalf("unexpected extra %v", profile.Extra)
+	}
+
+	if err := setField(value.Field(4), nil, false); err != nil || profile.Nickname != nil {
+		t.Fatalf("want nil nickname, got %v %v", profile.Nickname, err)
+	}
+
+	sql, args, err := BuildInsertByObj(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "INSERT INTO `profile`(`birthday`,`login_at`,`score`,`avatar`,`extra`)VALUES(?,?,?,?,?)"
+	if sql != want {
+		t.Fatalf("want %s, got %s", want, sql)
+	}
+
+	if args[4] != `{"vip":true}` {
+		t.Fatalf("unexpected json arg %v", args[4])
+	}
+
+	var enabled bool
+	for literal, want := range map[string]bool{"1": true, "true": true, "TRUE": true, "t": true, "0": false, "false": false, "yes": false} {
+		if err = setField(reflect.ValueOf(&enabled).Elem(), []byte(literal), false); err != nil || enabled != want {
+			t.Fatalf("%s: want %v, got %v %v", literal, want, enabled, err)
+		}
+	}
+}
+
+func TestModelMeta(t *testing.T) {
+	meta := getModelMeta(reflect.TypeOf(Account{}))
+	if meta != getModelMeta(reflect.TypeOf(Account{})) {
+		t.Fatal("want cached meta")
+	}
+
+	if meta.table != "account" || len(meta.fields) != 4 || len(meta.primaries) != 1 || meta.version == nil || meta.version.column != "version" {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+
+	if TableName(reflect.ValueOf(&Article{})) != "article" {
+		t.Fatal("want article")
+	}
+
+	//表名依赖字段值时使用实际对象
+	sql, _, err := BuildInsertByObj(dynTable{Id: 1, Part: "2024"})
+	if err != nil || sql != "INSERT INTO `dyn_2024`(`id`)VALUES(?)" {
+		t.Fatalf("unexpected sql %s %v", sql, err)
+	}
+
+	sql, _, err = BuildUpdateByObj(&dynTable{Id: 1, Name: "a", Part: "2025"})
+	if err != nil || sql != "UPDATE `dyn_2025` SET `name`=? WHERE `id` = ?" {
+		t.Fatalf("unexpected sql %s %v", sql, err)
+	}
+
+	if table := objTable([]*dynTable{{Part: "2023"}}); table != "dyn_2023" {
+		t.Fatalf("unexpected table %s", table)
+	}
+}
+
+type dynTable struct {
+	Id   int64  `bdb:"id,primary"`
+	Name string `bdb:"name"`
+	Part string
+}
+
+func (d *dynTable) TableName() string {
+	return "dyn_" + d.Part
+}
+
+// go test -run=^$ -bench=ModelMeta -benchmem
+// BenchmarkParseModelMeta    439628      3306 ns/op    1064 B/op    27 allocs/op
+// BenchmarkGetModelMeta    75029359     20.01 ns/op       0 B/op     0 allocs/op
+func BenchmarkParseModelMeta(b *testing.B) {
+	t := reflect.TypeOf(Article{})
+	for i := 0; i < b.N; i++ {
+		_ = parseModelMeta(t)
+	}
+}
+
+func BenchmarkGetModelMeta(b *testing.B) {
+	t := reflect.TypeOf(Article{})
+	for i := 0; i < b.N; i++ {
+		_ = getModelMeta(t)
+	}
+}
+
+// go test -run=^$ -bench=ByObj -benchmem
+// BenchmarkBuildInsertByObj    723885      1876 ns/op     328 B/op    14 allocs/op
+// BenchmarkBuildUpdateByObj    298231      4220 ns/op     928 B/op    31 allocs/op
+func BenchmarkBuildInsertByObj(b *testing.B) {
+	user := &User{Id: 1, NickName: "boot"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, args, _ := BuildInsertByObj(user)
+		boot.ReleaseArgs(&args)
+	}
+}
+
+func BenchmarkBuildUpdateByObj(b *testing.B) {
+	account := &Account{Id: 1, Balance: 100, Version: 3}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, args, _ := BuildUpdateByObj(account)
+		boot.ReleaseArgs(&args)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	var (
+		table   = []Account{{Id: 1}, {Id: 2}, {Id: 3}, {Id: 4}, {Id: 5}}
+		sqlList []string
+		find    = func(ctx context.Context, query *Query, dest interface{}) error {
+			sqlStr, args, _ := buildQuery(query)
+			sqlList = append(sqlList, sqlStr)
+
+			var after int64
+			if len(args) > 0 {
+				after = args[len(args)-1].(int64)
+			}
+
+			list := dest.(*[]Account)
+			*list = (*list)[:0]
+			for _, row := range table {
+				if row.Id > after && int64(len(*list)) < query.limit {
+					*list = append(*list, row)
+				}
+			}
+			return nil
+		}
+		batches []Account
+	)
+
+	query := AcquireQuery().From("account").Where(map[string]interface{}{"balance >": int64(0)}).Order("balance DESC").Limit(10, 3)
+	defer ReleaseQuery(query)
+
+	cursor, err := chunk(context.Background(), find, query, &batches, &ChunkOption{Size: 2}, func(cursor interface{}) error {
+		if cursor.(int64) == 4 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err == nil || cursor != int64(2) {
+		t.Fatalf("want cursor 2 with error, got %v %v", cursor, err)
+	}
+
+	want := "SELECT * FROM account WHERE (`balance` > ? AND `id` > ?) ORDER BY `id` LIMIT 0,2"
+	if sqlList[1] != want {
+		t.Fatalf("want %s, got %s", want, sqlList[1])
+	}
+
+	//调用方的query不被修改
+	sqlStr, _, _ := buildQuery(query)
+	want = "SELECT * FROM account WHERE `balance` > ? ORDER BY `balance` DESC LIMIT 10,3"
+	if sqlStr != want {
+		t.Fatalf("want %s, got %s", want, sqlStr)
+	}
+
+	var ids []int64
+	cursor, err = each(context.Background(), find, query, &batches, &ChunkOption{Size: 2, Cursor: cursor}, func(row interface{}) error {
+		ids = append(ids, row.(Account).Id)
+		return nil
+	})
+	if err != nil || cursor != int64(5) || len(ids) != 3 || ids[0] != 3 {
+		t.Fatalf("unexpected resume %v %v %v", cursor, ids, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = chunk(ctx, find, query, &batches, nil, func(cursor interface{}) error { return nil }); err != context.Canceled {
+		t.Fatalf("want canceled, got %v", err)
+	}
+}
+
+func TestSplitRows(t *testing.T) {
+	rows := make([]map[string]interface{}, 0, 10)
+	for i := 0; i < 10; i++ {
+		rows = append(rows, map[string]interface{}{"id": i, "nickname": strings.Repeat("a", 100)})
+	}
+
+	batches := splitRows("user", rows, &BatchOption{MaxRows: 4})
+	if len(batches) != 3 || len(batches[0]) != 4 || len(batches[2]) != 2 {
+		t.Fatalf("unexpected batches by rows %d", len(batches))
+	}
+
+	batches = splitRows("user", rows, &BatchOption{MaxRows: 100, MaxBytes: 400})
+	total := 0
+	for _, batch := range batches {
+		if len(batch) < 1 || len(batch) > 3 {
+			t.Fatalf("unexpected batch size %d", len(batch))
+		}
+		total += len(batch)
+	}
+
+	if total != len(rows) {
+		t.Fatalf("want %d rows, got %d", len(rows), total)
+	}
+
+	if splitRows("user", nil, nil) != nil {
+		t.Fatal("want nil batches")
+	}
+
+	result := &ExecResult{}
+	result.add(&ExecResult{LastInsertId: 10, AffectedRows: 4})
+	result.add(&ExecResult{LastInsertId: 14, AffectedRows: 2})
+	if result.LastInsertId != 10 || result.AffectedRows != 6 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestQueryCache_RowSet(t *testing.T) {
+	query := AcquireQuery().From("user").Alias("u").LeftJoin("order", "o", On("u.id", "o.user_id")).Cache(0)
+	defer ReleaseQuery(query)
+
+	tables := query.tables(nil)
+	if len(tables) != 2 || tables[0] != "user" || tables[1] != "order" {
+		t.Fatalf("unexpected tables %v", tables)
+	}
+
+	//引号不同的表名使用同一个标签
+	cache := NewQueryCache(nil, nil)
+	if cache.tagKey("`user`") != cache.tagKey(objTable(User{})) || cache.tagKey("`db`.`user`") != cache.tagKey("db.user") {
+		t.Fatalf("unexpected tag key %s", cache.tagKey("`user`"))
+	}
+
+	data, err := json.Marshal(&rowSet{
+		Columns: []string{"id", "nickname", "unknown"},
+		Rows:    [][][]byte{{[]byte("1"), []byte("boot"), nil}, {[]byte("2"), nil, nil}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := &rowSet{}
+	if err = json.Unmarshal(data, set); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []*User
+	if err = set.fillObjs(&users); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != 2 || users[0].NickName != "boot" || users[1].Id != 2 || users[1].NickName != "" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+
+	var user User
+	if err = set.fillObj(&user); err != nil || user.Id != 1 {
+		t.Fatalf("unexpected user %+v %v", user, err)
+	}
+}
+
+func TestFlightGroup_Do(t *testing.T) {
+	var (
+		flight flightGroup
+		calls  int32
+		start  = make(chan struct{})
+		done   = make(chan interface{}, 10)
+	)
+
+	for i := 0; i < 10; i++ {
+		go func() {
+			<-start
+			value, _ := flight.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(50 * time.Millisecond)
+				return "value", nil
+			})
+			done <- value
+		}()
+	}
+
+	close(start)
+	for i := 0; i < 10; i++ {
+		if value := <-done; value != "value" {
+			t.Fatalf("unexpected value %v", value)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("want 1 call, got %d", calls)
+	}
+}
+
+func TestPool_DryRun(t *testing.T) {
+	pool, err := NewPool(&PoolOption{Dsn: "root:123456@tcp(127.0.0.1:3306)/test", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pool.InsertObj(&User{Id: 1, NickName: "boot"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pool.UpdateAll("user", map[string]interface{}{"nickname": "grpc"}, map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	query := AcquireQuery().From("user").Where(map[string]interface{}{"id": 1})
+	defer ReleaseQuery(query)
+
+	if _, err = pool.Find(query); err != ErrDryRun {
+		t.Fatalf("want ErrDryRun, got %v", err)
+	}
+
+	if err = pool.Transact(context.Background(), func(tx *Transaction) error { return nil }); err != ErrDryRun {
+		t.Fatalf("want ErrDryRun, got %v", err)
+	}
+
+	statements := pool.Statements()
+	if len(statements) != 3 || statements[0].Args[1] != "boot" || !strings.HasPrefix(statements[1].Sql, "UPDATE user SET") {
+		t.Fatalf("unexpected statements %+v", statements)
+	}
+
+	sql, args, err := query.Build()
+	if err != nil || sql != statements[2].Sql || len(args) != 1 {
+		t.Fatalf("want %s, got %s %v", statements[2].Sql, sql, err)
+	}
+
+	pool.ResetStatements()
+	if len(pool.Statements()) != 0 {
+		t.Fatal("want empty statements")
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	set := &rowSet{
+		Columns: []string{"id", "select_type", "table", "type", "possible_keys", "key", "rows", "filtered", "Extra"},
+		Rows: [][][]byte{
+			{[]byte("1"), []byte("SIMPLE"), []byte("u"), []byte("ALL"), nil, nil, []byte("1000"), []byte("10.00"), []byte("Using where; Using filesort")},
+			{[]byte("1"), []byte("SIMPLE"), []byte("o"), []byte("ref"), []byte("idx_user"), []byte("idx_user"), []byte("3"), []byte("100.00"), nil},
+		},
+	}
+
+	result := parseExplain("SELECT 1", nil, set)
+	if !result.FullScan || !result.Filesort || len(result.Rows) != 2 || result.Rows[0].Rows != 1000 || result.Rows[1].Key != "idx_user" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if tables := result.FullScanTables(); len(tables) != 1 || tables[0] != "u" {
+		t.Fatalf("unexpected full scan tables %v", tables)
+	}
+}
+
+type fakeDriver struct {
+	prepared   int32
+	closed     int32
+	commits    int32
+	rollbacks  int32
+	maxPrepare int32
+}
+
+var fakeDriverSeq int32
+
+// registerFakeDriver 每次注册新的驱动名，返回驱动名
+func registerFakeDriver(fake *fakeDriver) string {
+	name := "fake-" + strconv.Itoa(int(atomic.AddInt32(&fakeDriverSeq, 1)))
+	sql.Register(name, fake)
+	return name
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{driver: d}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt32(&c.driver.prepared, 1)
+	return &fakeStmt{driver: c.driver}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{driver: c.driver}, nil
+}
+
+type fakeTx struct {
+	driver *fakeDriver
+}
+
+func (tx *fakeTx) Commit() error {
+	atomic.AddInt32(&tx.driver.commits, 1)
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	atomic.AddInt32(&tx.driver.rollbacks, 1)
+	return nil
+}
+
+type fakeStmt struct {
+	driver *fakeDriver
+}
+
+func (s *fakeStmt) Close() error {
+	atomic.AddInt32(&s.driver.closed, 1)
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestStmtCache(t *testing.T) {
+	fake := &fakeDriver{}
+	db, err := sql.Open(registerFakeDriver(fake), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		ctx   = context.Background()
+		cache = newStmtCache(2)
+	)
+
+	for _, sqlStr := range []string{"a", "b", "a", "c"} {
+		if _, err = cache.exec(ctx, db, sqlStr, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//b被淘汰
+	if cache.Len() != 2 || atomic.LoadInt32(&fake.prepared) != 3 || atomic.LoadInt32(&fake.closed) != 1 {
+		t.Fatalf("unexpected cache len %d prepared %d closed %d", cache.Len(), fake.prepared, fake.closed)
+	}
+
+	//使用中的语句被淘汰后，释放时才关闭
+	entry, err := cache.acquire(ctx, db, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sqlStr := range []string{"d", "e"} {
+		if _, err = cache.exec(ctx, db, sqlStr, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !entry.evicted || atomic.LoadInt32(&fake.closed) != 2 {
+		t.Fatalf("want evicted entry kept open, closed %d", fake.closed)
+	}
+
+	cache.release(entry)
+	if atomic.LoadInt32(&fake.closed) != 3 {
+		t.Fatalf("want closed after release, closed %d", fake.closed)
+	}
+}
+
+func TestMigrator_ApplyRaw(t *testing.T) {
+	pool, err := NewPool(&PoolOption{Driver: registerFakeDriver(&fakeDriver{}), StmtCacheSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var intercepted int
+	pool.Use(AfterFunc(func(ctx context.Context, stmt *Statement) {
+		intercepted++
+	}))
+
+	conn, err := pool.db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	migrator := NewMigrator(pool, nil)
+	_ = migrator.RegisterSql(1, "create_user", "CREATE TABLE a(id int);INSERT INTO a VALUES(1)", "")
+	if err = migrator.apply(context.Background(), conn, migrator.migrations[1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	//迁移不经过拦截器及语句缓存
+	if intercepted != 0 || pool.stmts.Len() != 0 {
+		t.Fatalf("want raw execution, got %d intercepted %d cached", intercepted, pool.stmts.Len())
+	}
+}
+
+func TestGroup_TransactNoRetry(t *testing.T) {
+	driverName := registerFakeDriver(&fakeDriver{})
+	g := NewGroup(&GroupOption{
+		Masters: []PoolOption{{Driver: driverName}, {Driver: driverName}},
+	})
+
+	var calls int
+	err := g.Transact(context.Background(), func(tx *Transaction) error {
+		calls++
+		return driver.ErrBadConn
+	})
+
+	//连接断开时不在其他主库上重新执行handler
+	if err != driver.ErrBadConn || calls != 1 {
+		t.Fatalf("want one call and ErrBadConn, got %d %v", calls, err)
+	}
+
+	if len(g.GetBadPool(true)) != 1 {
+		t.Fatalf("want master marked down, got %v", g.GetBadPool(true))
+	}
+}
+
+func TestGroup_SetBalancerRace(t *testing.T) {
+	driverName := registerFakeDriver(&fakeDriver{})
+	g := NewGroup(&GroupOption{
+		Masters: []PoolOption{{Driver: driverName}, {Driver: driverName}},
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _, _ = g.GetMaster()
+			_, _, _ = g.GetSlave()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		g.SetBalancer(i%2 == 0, &RoundRobinBalancer{})
+		g.SetBalancer(i%2 == 0, &LeastLatencyBalancer{})
+	}
+	wg.Wait()
+
+	if _, ok := loadBalancer(&g.masterBalancer).(*LeastLatencyBalancer); !ok {
+		t.Fatalf("unexpected balancer %T", loadBalancer(&g.masterBalancer))
+	}
+}
+
+func TestGroup_TransactLatency(t *testing.T) {
+	g := NewGroup(&GroupOption{
+		Masters: []PoolOption{{Driver: registerFakeDriver(&fakeDriver{})}},
+	})
+
+	err := g.Transact(context.Background(), func(tx *Transaction) error {
+		if _, err := tx.Execute("UPDATE t SET a = 1"); err != nil {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//只统计语句耗时，不包含handler的处理时间
+	if latency := g.masters[0].Latency(); latency <= 0 || latency >= 50*time.Millisecond {
+		t.Fatalf("want statement latency, got %v", latency)
+	}
+}
+
+func TestGroup_TransactCallbackFailed(t *testing.T) {
+	g := NewGroup(&GroupOption{
+		Masters:        []PoolOption{{Driver: registerFakeDriver(&fakeDriver{})}},
+		StickyInterval: 1000,
+	})
+
+	var (
+		session = NewSession()
+		ctx     = WithSession(context.Background(), session)
+		marked  bool
+	)
+
+	err := g.Transact(ctx, func(tx *Transaction) error {
+		tx.OnCommit(func() error {
+			marked = session.Sticky(time.Second)
+			return errors.New("notify failed")
+		})
+		return nil
+	})
+
+	//已提交，回调失败不影响写入标记，且标记先于回调执行
+	var callbackErr *CallbackError
+	if !errors.As(err, &callbackErr) || !marked || session.LastWrite().IsZero() {
+		t.Fatalf("want session marked before callbacks, got %v %v", marked, err)
+	}
+
+	err = g.Transact(ctx, func(tx *Transaction) error {
+		tx.OnRollback(func() error {
+			return errors.New("cleanup failed")
+		})
+		return errors.New("handler failed")
+	})
+
+	if err == nil || strings.Contains(err.Error(), "rollback failed") || !strings.Contains(err.Error(), "cleanup failed") {
+		t.Fatalf("want callback error, got %v", err)
+	}
+}
+
+func TestTransaction_RollbackAfterCancel(t *testing.T) {
+	fake := &fakeDriver{}
+	pool, err := NewPool(&PoolOption{Driver: registerFakeDriver(fake)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rolledBack int
+	tx.OnRollback(func() error {
+		rolledBack++
+		return nil
+	})
+
+	//等待database/sql因上下文取消自动回滚
+	cancel()
+	for atomic.LoadInt32(&fake.rollbacks) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err = tx.Rollback(); err != nil || rolledBack != 1 {
+		t.Fatalf("want rollback callback, got %d %v", rolledBack, err)
+	}
+
+	if err = tx.Rollback(); err != sql.ErrTxDone || rolledBack != 1 {
+		t.Fatalf("want ErrTxDone without callbacks, got %d %v", rolledBack, err)
+	}
+}
+
+func TestTransaction_StmtSingleConn(t *testing.T) {
+	fake := &fakeDriver{}
+	pool, err := NewPool(&PoolOption{Driver: registerFakeDriver(fake), MaxOpenConns: 1, StmtCacheSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pool.Execute("UPDATE a"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	//事务占用唯一的连接，未命中缓存的语句需在事务连接上prepare
+	err = pool.Transact(ctx, func(tx *Transaction) error {
+		for _, sqlStr := range []string{"UPDATE a", "UPDATE b", "UPDATE b"} {
+			if _, err := tx.ExecuteContext(ctx, sqlStr); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := pool.stmts.get("UPDATE a")
+	if pool.stmts.Len() != 1 || entry == nil || entry.refs != 1 {
+		t.Fatalf("want only pool statement cached and released, len %d", pool.stmts.Len())
+	}
+	pool.stmts.release(entry)
+}
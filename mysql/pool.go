@@ -3,20 +3,37 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"sync/atomic"
 	"time"
 
 	"github.com/grpc-boot/boot"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	latencyDecay = 8
 )
 
 type PoolOption struct {
+	//名称，用于日志及Interceptor中区分连接池，默认为"host:port/dbName"
+	Name string `yaml:"name" json:"name"`
 	//格式："userName:password@schema(host:port)/dbName"，如：root:123456@tcp(127.0.0.1:3306)/test
 	Dsn string `yaml:"dsn" json:"dsn"`
 	//单位s
 	MaxConnLifetime int `yaml:"maxConnLifetime" json:"maxConnLifetime"`
 	MaxOpenConns    int `yaml:"maxOpenConns" json:"maxOpenConns"`
 	MaxIdleConns    int `yaml:"maxIdleConns" json:"maxIdleConns"`
+	//权重，用于Group加权选择，默认为1
+	Weight int `yaml:"weight" json:"weight"`
+	//只记录语句不执行，用于测试及查看生成的sql
+	DryRun bool `yaml:"dryRun" json:"dryRun"`
+	//预处理语句LRU缓存的容量，为0时不缓存
+	StmtCacheSize int `yaml:"stmtCacheSize" json:"stmtCacheSize"`
+	//方言：mysql、postgres、sqlite，默认为mysql
+	Dialect string `yaml:"dialect" json:"dialect"`
+	//sql.Open使用的驱动名，默认由Dialect决定，驱动需自行导入
+	Driver string `yaml:"driver" json:"driver"`
 }
 
 type ExecResult struct {
@@ -25,11 +42,28 @@ type ExecResult struct {
 }
 
 type Pool struct {
-	db *sql.DB
+	db           *sql.DB
+	name         string
+	weight       int
+	latency      int64
+	interceptors []Interceptor
+	recorder     *recorder
+	stmts        *stmtCache
+	dialect      Dialect
 }
 
 func NewPool(option *PoolOption) (*Pool, error) {
-	db, err := sql.Open("mysql", option.Dsn)
+	dialect, err := NewDialect(option.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	driverName := option.Driver
+	if driverName == "" {
+		driverName = dialect.Driver()
+	}
+
+	db, err := sql.Open(driverName, option.Dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -38,225 +72,407 @@ func NewPool(option *PoolOption) (*Pool, error) {
 	db.SetMaxIdleConns(option.MaxIdleConns)
 	db.SetMaxOpenConns(option.MaxOpenConns)
 
-	return &Pool{
-		db: db,
-	}, nil
+	pool := &Pool{
+		db:      db,
+		name:    option.Name,
+		weight:  option.Weight,
+		dialect: dialect,
+	}
+
+	if pool.name == "" {
+		pool.name = dialect.Name()
+		if _, ok := dialect.(MysqlDialect); ok {
+			if config, err := mysql.ParseDSN(option.Dsn); err == nil {
+				pool.name = config.Addr + "/" + config.DBName
+			}
+		}
+	}
+
+	if pool.weight < 1 {
+		pool.weight = 1
+	}
+
+	if option.DryRun {
+		pool.recorder = &recorder{}
+	}
+
+	if option.StmtCacheSize > 0 {
+		pool.stmts = newStmtCache(option.StmtCacheSize)
+	}
+
+	return pool, nil
 }
 
 func (p *Pool) Db() *sql.DB {
 	return p.db
 }
 
+func (p *Pool) Name() string {
+	return p.name
+}
+
+func (p *Pool) Dialect() Dialect {
+	return p.dialect
+}
+
+// Use 注册Interceptor，需在使用Pool前调用
+func (p *Pool) Use(interceptors ...Interceptor) {
+	p.interceptors = append(p.interceptors, interceptors...)
+}
+
+func (p *Pool) Weight() int {
+	return p.weight
+}
+
+// Latency 请求耗时的指数加权移动平均值
+func (p *Pool) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.latency))
+}
+
+func (p *Pool) observe(duration time.Duration) {
+	for {
+		old := atomic.LoadInt64(&p.latency)
+		latency := int64(duration)
+		if old > 0 {
+			latency = old + (latency-old)/latencyDecay
+		}
+
+		if atomic.CompareAndSwapInt64(&p.latency, old, latency) {
+			return
+		}
+	}
+}
+
 func (p *Pool) Query(sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
-	return p.db.Query(sqlStr, args...)
+	return p.QueryContext(context.Background(), sqlStr, args...)
 }
 
-func (p *Pool) Execute(sqlStr string, args ...interface{}) (result *ExecResult, err error) {
-	res, err := p.db.Exec(sqlStr, args...)
-	if err != nil {
+// QueryContext sql使用MySQL形式，执行前按方言转换
+func (p *Pool) QueryContext(ctx context.Context, sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
+	sqlStr = p.dialect.Rebind(sqlStr)
+	if p.recorder != nil {
+		p.recorder.record(p, sqlStr, args)
+		return nil, ErrDryRun
+	}
+
+	err = intercept(ctx, p.interceptors, &Statement{Sql: sqlStr, Args: args, Pool: p}, func(ctx context.Context) (e error) {
+		if p.stmts != nil {
+			rows, e = p.stmts.query(ctx, p.db, sqlStr, args)
+			return
+		}
+
+		rows, e = p.db.QueryContext(ctx, sqlStr, args...)
 		return
+	})
+	return
+}
+
+func (p *Pool) Execute(sqlStr string, args ...interface{}) (result *ExecResult, err error) {
+	return p.ExecuteContext(context.Background(), sqlStr, args...)
+}
+
+// ExecuteContext sql使用MySQL形式，执行前按方言转换
+func (p *Pool) ExecuteContext(ctx context.Context, sqlStr string, args ...interface{}) (result *ExecResult, err error) {
+	sqlStr = p.dialect.Rebind(sqlStr)
+	if p.recorder != nil {
+		p.recorder.record(p, sqlStr, args)
+		return &ExecResult{}, nil
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+	var res sql.Result
+	err = intercept(ctx, p.interceptors, &Statement{Sql: sqlStr, Args: args, Pool: p}, func(ctx context.Context) (e error) {
+		if p.stmts != nil {
+			res, e = p.stmts.exec(ctx, p.db, sqlStr, args)
+			return
+		}
+
+		res, e = p.db.ExecContext(ctx, sqlStr, args...)
+		return
+	})
+
 	if err != nil {
 		return nil, err
 	}
 
-	result.LastInsertId, err = res.LastInsertId()
+	return newExecResult(res)
+}
+
+func (p *Pool) Find(query *Query) (*sql.Rows, error) {
+	return p.FindContext(context.Background(), query)
+}
+
+func (p *Pool) FindContext(ctx context.Context, query *Query) (*sql.Rows, error) {
+	sqlStr, args, err := buildQuery(query)
 	if err != nil {
 		return nil, err
 	}
-	return
-}
 
-func (p *Pool) Find(query *Query) (*sql.Rows, error) {
-	sqlStr, args := buildQuery(query)
 	defer func() {
 		boot.ReleaseArgs(&args)
 	}()
-	return p.db.Query(sqlStr, args...)
+	return p.QueryContext(ctx, sqlStr, args...)
 }
 
-func (p *Pool) Insert(table string, row map[string]interface{}) (result *ExecResult, err error) {
-	var (
-		sqlStr string
-		args   []interface{}
-	)
-
-	sqlStr, args = buildInsertByMap(table, row)
+func (p *Pool) FindAll(query *Query, dest interface{}) error {
+	return p.FindAllContext(context.Background(), query, dest)
+}
 
-	res, err := p.db.Exec(sqlStr, args...)
-	boot.ReleaseArgs(&args)
+func (p *Pool) FindAllContext(ctx context.Context, query *Query, dest interface{}) error {
+	rows, err := p.FindContext(ctx, query.Model(dest))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
-	if err != nil {
-		return nil, err
-	}
+	return Rows2Objs(rows, dest)
+}
+
+func (p *Pool) Insert(table string, row map[string]interface{}) (result *ExecResult, err error) {
+	return p.InsertContext(context.Background(), table, row)
+}
 
-	result.LastInsertId, err = res.LastInsertId()
+func (p *Pool) InsertContext(ctx context.Context, table string, row map[string]interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := buildInsertByMap(table, row)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	boot.ReleaseArgs(&args)
 	return
 }
 
 func (p *Pool) BatchInsert(table string, rows []map[string]interface{}) (result *ExecResult, err error) {
-	var (
-		sqlStr string
-		args   []interface{}
-	)
+	return p.BatchInsertContext(context.Background(), table, rows)
+}
+
+// BatchInsertContext 按默认的行数及字节数上限拆分执行，见BatchInsertWithOption
+func (p *Pool) BatchInsertContext(ctx context.Context, table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return p.BatchInsertWithOption(ctx, table, rows, nil)
+}
 
-	sqlStr, args = buildInsertByMap(table, rows...)
+type UpsertOption struct {
+	//冲突检测字段，PostgreSQL必须指定，MySQL仅用于从默认更新字段中排除
+	Keys []string `yaml:"keys" json:"keys"`
+	//冲突时更新的字段，为空时更新除Keys外的所有插入字段
+	UpdateColumns []string `yaml:"updateColumns" json:"updateColumns"`
+}
 
-	res, err := p.db.Exec(sqlStr, args...)
-	if err != nil {
-		return nil, err
+func (o *UpsertOption) fields() (keys []string, updateColumns []string) {
+	if o == nil {
+		return nil, nil
 	}
+	return o.Keys, o.UpdateColumns
+}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+func (p *Pool) Upsert(table string, row map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return p.UpsertContext(context.Background(), table, row, updateColumns...)
+}
+
+func (p *Pool) UpsertContext(ctx context.Context, table string, row map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return p.UpsertWithOption(ctx, table, []map[string]interface{}{row}, &UpsertOption{UpdateColumns: updateColumns})
+}
+
+func (p *Pool) BatchUpsert(table string, rows []map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return p.BatchUpsertContext(context.Background(), table, rows, updateColumns...)
+}
+
+func (p *Pool) BatchUpsertContext(ctx context.Context, table string, rows []map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return p.UpsertWithOption(ctx, table, rows, &UpsertOption{UpdateColumns: updateColumns})
+}
+
+// UpsertWithOption PostgreSQL需通过option.Keys指定冲突检测字段
+func (p *Pool) UpsertWithOption(ctx context.Context, table string, rows []map[string]interface{}, option *UpsertOption) (result *ExecResult, err error) {
+	keys, updateColumns := option.fields()
+	sqlStr, args, err := buildUpsert(p.dialect, table, keys, updateColumns, rows...)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	if len(rows) == 1 {
+		boot.ReleaseArgs(&args)
+	}
 	return
 }
 
-func (p *Pool) UpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
-	sqlStr, args := buildUpdateAll(table, set, where)
-	res, err := p.db.Exec(sqlStr, args...)
-	boot.ReleaseArgs(&args)
-	if err != nil {
-		return nil, err
+func (p *Pool) Replace(table string, row map[string]interface{}) (result *ExecResult, err error) {
+	return p.ReplaceContext(context.Background(), table, row)
+}
+
+func (p *Pool) ReplaceContext(ctx context.Context, table string, row map[string]interface{}) (result *ExecResult, err error) {
+	if !p.dialect.SupportsReplace() {
+		return nil, ErrUnsupportedDialect
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+	sqlStr, args, err := buildReplaceByMap(table, row)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	boot.ReleaseArgs(&args)
 	return
 }
 
-func (p *Pool) DeleteAll(table string, where map[string]interface{}) (result *ExecResult, err error) {
-	sqlStr, args := buildDeleteAll(table, where)
-	res, err := p.db.Exec(sqlStr, args...)
-	boot.ReleaseArgs(&args)
+func (p *Pool) BatchReplace(table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return p.BatchReplaceContext(context.Background(), table, rows)
+}
+
+func (p *Pool) BatchReplaceContext(ctx context.Context, table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	if !p.dialect.SupportsReplace() {
+		return nil, ErrUnsupportedDialect
+	}
+
+	sqlStr, args, err := buildReplaceByMap(table, rows...)
 	if err != nil {
 		return nil, err
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+	return p.ExecuteContext(ctx, sqlStr, args...)
+}
+
+func (p *Pool) UpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
+	return p.UpdateAllContext(context.Background(), table, set, where)
+}
+
+func (p *Pool) UpdateAllContext(ctx context.Context, table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := buildUpdateAll(table, set, where)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	boot.ReleaseArgs(&args)
 	return
 }
 
-func (p *Pool) Begin() (trans *Transaction, err error) {
-	tx, err := p.db.Begin()
+func (p *Pool) DeleteAll(table string, where map[string]interface{}) (result *ExecResult, err error) {
+	return p.DeleteAllContext(context.Background(), table, where)
+}
+
+func (p *Pool) DeleteAllContext(ctx context.Context, table string, where map[string]interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := buildDeleteAll(table, where)
 	if err != nil {
 		return nil, err
 	}
 
-	return newTx(tx), err
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	boot.ReleaseArgs(&args)
+	return
+}
+
+func (p *Pool) Begin() (trans *Transaction, err error) {
+	return p.BeginTx(context.Background(), nil)
 }
 
 func (p *Pool) BeginTx(ctx context.Context, opts *sql.TxOptions) (trans *Transaction, err error) {
+	if p.recorder != nil {
+		return nil, ErrDryRun
+	}
+
 	tx, err := p.db.BeginTx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return newTx(tx), err
+	return newTx(tx, p), err
 }
 
 func (p *Pool) InsertObj(obj interface{}) (result *ExecResult, err error) {
-	var (
-		sqlStr string
-		args   []interface{}
-	)
+	return p.InsertObjContext(context.Background(), obj)
+}
 
-	sqlStr, args, err = BuildInsertByObj(obj)
+func (p *Pool) InsertObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := BuildInsertByObj(obj)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	res, err := p.db.Exec(sqlStr, args...)
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
 	boot.ReleaseArgs(&args)
-	if err != nil {
-		return nil, err
-	}
+	return
+}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
-	if err != nil {
-		return nil, err
-	}
+func (p *Pool) UpsertObj(obj interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return p.UpsertObjContext(context.Background(), obj, updateColumns...)
+}
 
-	result.LastInsertId, err = res.LastInsertId()
+func (p *Pool) UpsertObjContext(ctx context.Context, obj interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	sqlStr, args, err := buildUpsertByObj(p.dialect, obj, updateColumns)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	boot.ReleaseArgs(&args)
 	return
 }
 
-func (p *Pool) DeleteObj(obj interface{}) (result *ExecResult, err error) {
-	var (
-		sqlStr string
-		args   []interface{}
-	)
+func (p *Pool) ReplaceObj(obj interface{}) (result *ExecResult, err error) {
+	return p.ReplaceObjContext(context.Background(), obj)
+}
 
-	sqlStr, args, err = BuildDeleteByObj(obj)
-	if err != nil {
-		return nil, err
+func (p *Pool) ReplaceObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	if !p.dialect.SupportsReplace() {
+		return nil, ErrUnsupportedDialect
 	}
 
-	res, err := p.db.Exec(sqlStr, args...)
-
+	sqlStr, args, err := BuildReplaceByObj(obj)
 	if err != nil {
 		return nil, err
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	boot.ReleaseArgs(&args)
+	return
+}
+
+func (p *Pool) DeleteObj(obj interface{}) (result *ExecResult, err error) {
+	return p.DeleteObjContext(context.Background(), obj)
+}
+
+func (p *Pool) DeleteObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := BuildDeleteByObj(obj)
 	if err != nil {
 		return nil, err
 	}
-	return
+
+	return p.ExecuteContext(ctx, sqlStr, args...)
 }
 
 func (p *Pool) UpdateObj(obj interface{}) (result *ExecResult, err error) {
-	var (
-		sqlStr string
-		args   []interface{}
-	)
+	return p.UpdateObjContext(context.Background(), obj)
+}
 
-	sqlStr, args, err = BuildUpdateByObj(obj)
+// UpdateObjContext 带version标签时，未更新到数据返回ErrVersionConflict，成功后对象中的版本号加1
+func (p *Pool) UpdateObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	sqlStr, args, versionField, err := buildUpdateByObj(obj)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := p.db.Exec(sqlStr, args...)
+	result, err = p.ExecuteContext(ctx, sqlStr, args...)
+	boot.ReleaseArgs(&args)
+	if err != nil || !versionField.IsValid() {
+		return
+	}
 
-	if err != nil {
-		return nil, err
+	if result.AffectedRows < 1 {
+		return result, ErrVersionConflict
 	}
 
+	incrVersion(versionField)
+	return
+}
+
+func newExecResult(res sql.Result) (result *ExecResult, err error) {
 	result = &ExecResult{}
 	result.AffectedRows, err = res.RowsAffected()
 	if err != nil {
 		return nil, err
 	}
+
+	//PostgreSQL等驱动不支持LastInsertId，忽略该错误
+	result.LastInsertId, _ = res.LastInsertId()
 	return
 }
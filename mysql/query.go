@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +18,17 @@ const (
 	defaultLimit = 1000
 )
 
+const (
+	insertVerb  = "INSERT INTO "
+	replaceVerb = "REPLACE INTO "
+)
+
+const (
+	InnerJoin = "INNER JOIN"
+	LeftJoin  = "LEFT JOIN"
+	RightJoin = "RIGHT JOIN"
+)
+
 var (
 	defaultColumns = "*"
 	wherePrefix    = []byte(" WHERE ")
@@ -40,47 +53,194 @@ var (
 )
 
 type Query struct {
-	table   string
-	columns string
-	where   map[string]interface{}
-	group   string
-	having  string
-	order   string
-	offset  int64
-	limit   int64
+	table    string
+	alias    string
+	subQuery *Query
+	joins    []join
+	columns  string
+	where    Condition
+	group    string
+	having   string
+	order    string
+	offset   int64
+	limit    int64
+	//是否调用过Limit或Offset，子查询仅在显式设置时生成LIMIT
+	limited bool
+
+	softDelete  Condition
+	withDeleted bool
+
+	cache    bool
+	cacheTtl int64
+
+	//Select、Order、Group中第一个不合法的标识符错误
+	err error
+}
+
+type join struct {
+	joinType string
+	table    string
+	subQuery *Query
+	alias    string
+	on       Condition
 }
 
 //---------------------查询对象池--------------------------
 
 func (q *Query) reset() *Query {
 	q.table = ""
+	q.alias = ""
+	q.subQuery = nil
+	q.joins = nil
 	q.columns = defaultColumns
 	q.offset = 0
 	q.limit = defaultLimit
+	q.limited = false
 	q.where = nil
 	q.group = ""
 	q.having = ""
 	q.order = ""
+	q.softDelete = nil
+	q.withDeleted = false
+	q.cache = false
+	q.cacheTtl = 0
+	q.err = nil
 
 	return q
 }
 
 func (q *Query) From(table string) *Query {
 	q.table = table
+	q.subQuery = nil
+	return q
+}
+
+// FromQuery 以子查询作为数据源，MySQL要求派生表必须有别名
+func (q *Query) FromQuery(subQuery *Query, alias string) *Query {
+	q.table = ""
+	q.subQuery = subQuery
+	q.alias = alias
+	return q
+}
+
+func (q *Query) Alias(alias string) *Query {
+	q.alias = alias
+	return q
+}
+
+func (q *Query) Join(joinType string, table string, alias string, on Condition) *Query {
+	q.joins = append(q.joins, join{joinType: joinType, table: table, alias: alias, on: on})
+	return q
+}
+
+func (q *Query) JoinQuery(joinType string, subQuery *Query, alias string, on Condition) *Query {
+	q.joins = append(q.joins, join{joinType: joinType, subQuery: subQuery, alias: alias, on: on})
+	return q
+}
+
+func (q *Query) InnerJoin(table string, alias string, on Condition) *Query {
+	return q.Join(InnerJoin, table, alias, on)
+}
+
+func (q *Query) LeftJoin(table string, alias string, on Condition) *Query {
+	return q.Join(LeftJoin, table, alias, on)
+}
+
+func (q *Query) RightJoin(table string, alias string, on Condition) *Query {
+	return q.Join(RightJoin, table, alias, on)
+}
+
+// Model 根据bdb标签对象设置表名(未设置时)，带deleted_at标签时默认排除已软删除的数据
+func (q *Query) Model(obj interface{}) *Query {
+	t := modelType(obj)
+	if t == nil {
+		return q
+	}
+
+	if q.table == "" && q.subQuery == nil {
+		table, err := QuoteIdentifier(TableName(reflect.New(t).Elem()))
+		if err != nil {
+			q.setErr(err)
+			return q
+		}
+		q.table = table
+	}
+
+	q.softDelete = softDeleteCondition(t, q.alias)
+	return q
+}
+
+// WithDeleted 查询结果包含已软删除的数据
+func (q *Query) WithDeleted() *Query {
+	q.withDeleted = true
 	return q
 }
 
+// Cache 使用Group的查询缓存，ttl单位s，小于1时使用CacheOption.Ttl，仅对Group的FindOne和FindAll生效
+func (q *Query) Cache(ttl int64) *Query {
+	q.cache = true
+	q.cacheTtl = ttl
+	return q
+}
+
+// tables 数据源及连接的表名，用于缓存失效，条件中的子查询不包含在内
+func (q *Query) tables(list []string) []string {
+	if q.subQuery != nil {
+		list = q.subQuery.tables(list)
+	} else if q.table != "" {
+		list = append(list, q.table)
+	}
+
+	for _, j := range q.joins {
+		if j.subQuery != nil {
+			list = j.subQuery.tables(list)
+		} else {
+			list = append(list, j.table)
+		}
+	}
+	return list
+}
+
+// Select 每项为标识符或COUNT、SUM、AVG、MIN、MAX聚合，可带"AS 别名"，标识符会以反引号引用
 func (q *Query) Select(columns ...string) *Query {
+	quoted, err := quoteColumns(columns)
+	if err != nil {
+		q.setErr(err)
+		return q
+	}
+	q.columns = quoted
+	return q
+}
+
+// SelectRaw 原样使用columns，不做校验，不可包含外部输入
+func (q *Query) SelectRaw(columns ...string) *Query {
 	q.columns = strings.Join(columns, ",")
 	return q
 }
 
 func (q *Query) Where(where map[string]interface{}) *Query {
-	q.where = where
+	q.where = MapCondition(where)
 	return q
 }
 
+func (q *Query) WhereCondition(conditions ...Condition) *Query {
+	q.where = And(conditions...)
+	return q
+}
+
+// Group 每项为标识符
 func (q *Query) Group(fields ...string) *Query {
+	quoted, err := quoteFields(fields)
+	if err != nil {
+		q.setErr(err)
+		return q
+	}
+	q.group = " GROUP BY " + quoted
+	return q
+}
+
+// GroupRaw 原样使用fields，不做校验，不可包含外部输入
+func (q *Query) GroupRaw(fields ...string) *Query {
 	q.group = " GROUP BY " + strings.Join(fields, ",")
 	return q
 }
@@ -90,13 +250,26 @@ func (q *Query) Having(having string) *Query {
 	return q
 }
 
+// Order 每项为标识符，可带ASC或DESC，如Order("`created_at` DESC", "id")
 func (q *Query) Order(orders ...string) *Query {
+	quoted, err := quoteOrders(orders)
+	if err != nil {
+		q.setErr(err)
+		return q
+	}
+	q.order = " ORDER BY " + quoted
+	return q
+}
+
+// OrderRaw 原样使用orders，不做校验，不可包含外部输入，如OrderRaw("FIELD(`status`, 2, 1)")
+func (q *Query) OrderRaw(orders ...string) *Query {
 	q.order = " ORDER BY " + strings.Join(orders, ",")
 	return q
 }
 
 func (q *Query) Offset(offset int64) *Query {
 	q.offset = offset
+	q.limited = true
 	return q
 }
 
@@ -106,6 +279,7 @@ func (q *Query) Limit(offset int64, limit int64) *Query {
 	}
 	q.limit = limit
 	q.offset = offset
+	q.limited = true
 	return q
 }
 
@@ -117,79 +291,207 @@ func (q *Query) QueryByGroup(group *Group, useMaster bool) (*sql.Rows, error) {
 	return group.Find(q, useMaster)
 }
 
-func buildWhere(where map[string]interface{}) (condition []byte, args []interface{}) {
-	if len(where) < 1 {
-		return
-	}
+// Build 生成sql及参数，不回收Query；标识符或操作符不合法时返回错误
+func (q *Query) Build() (sql string, args []interface{}, err error) {
+	return buildQuery(q)
+}
 
-	buf := bytes.NewBuffer(wherePrefix)
+func (q *Query) setErr(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
 
-	var (
-		operator string
-		position int
-		inLength int
-	)
+// check 返回Query及其子查询、连接条件和WHERE条件中第一个不合法的标识符或操作符错误
+func (q *Query) check() error {
+	if q.err != nil {
+		return q.err
+	}
 
-	args = make([]interface{}, 0)
-	for field, value := range where {
-		operator = "="
-		position = strings.Index(field, " ")
-		if position > 0 {
-			operator = strings.ToUpper(field[position+1:])
-			field = field[:position]
+	if q.subQuery != nil {
+		if err := q.subQuery.check(); err != nil {
+			return err
 		}
+	}
 
-		if val, ok := value.([]interface{}); ok {
-			inLength = len(val)
-			if operator != "BETWEEN" {
-				operator = "IN"
+	for _, j := range q.joins {
+		if j.subQuery != nil {
+			if err := j.subQuery.check(); err != nil {
+				return err
 			}
-			args = append(args, val...)
-		} else {
-			args = append(args, value)
 		}
 
-		buf.WriteString(" (")
-		buf.WriteString(field)
-
-		switch operator {
-		case "IN":
-			buf.WriteString(" IN(")
-			buf.WriteString(strings.Repeat(inHolder, inLength)[:2*inLength-1])
-			buf.WriteString(")) AND")
-		case "BETWEEN":
-			buf.WriteString(" BETWEEN ? AND ?) AND")
-		case "LIKE":
-			buf.WriteString(" LIKE ?) AND")
-		default:
-			buf.WriteString(" ")
-			buf.WriteString(operator)
-			buf.WriteString(" ?) AND")
+		if err := conditionErr(j.on); err != nil {
+			return err
 		}
 	}
 
-	whereCon := buf.Bytes()
-	return whereCon[:len(whereCon)-3], args
+	return conditionErr(q.where)
 }
 
-func buildQuery(q *Query) (sql string, arguments []interface{}) {
-	where := ""
+func buildWhere(where Condition) (condition []byte, args []interface{}, err error) {
+	if where == nil {
+		return
+	}
+
+	if err = conditionErr(where); err != nil {
+		return nil, nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(wherePrefix)
+	args = where.Build(buf, make([]interface{}, 0))
+	return buf.Bytes(), args, nil
+}
+
+func buildQuery(q *Query) (sql string, arguments []interface{}, err error) {
+	if err = q.check(); err != nil {
+		return "", nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	arguments = q.build(buf, make([]interface{}, 0), true)
+	return buf.String(), arguments, nil
+}
+
+func (q *Query) build(buf *bytes.Buffer, args []interface{}, withLimit bool) []interface{} {
+	buf.WriteString("SELECT ")
+	buf.WriteString(q.columns)
+	buf.WriteString(" FROM ")
+	args = writeTable(buf, args, q.table, q.subQuery, q.alias)
+
+	for _, j := range q.joins {
+		buf.WriteByte(' ')
+		buf.WriteString(j.joinType)
+		buf.WriteByte(' ')
+		args = writeTable(buf, args, j.table, j.subQuery, j.alias)
+		if j.on != nil {
+			buf.WriteString(" ON ")
+			args = j.on.Build(buf, args)
+		}
+	}
+
+	where := q.where
+	if q.softDelete != nil && !q.withDeleted {
+		//用户条件整体加括号，避免其中的OR使软删除条件失效
+		where = And(parenthesize(where), q.softDelete)
+	}
+
+	if where != nil {
+		buf.Write(wherePrefix)
+		args = where.Build(buf, args)
+	}
+
+	buf.WriteString(q.group)
+	buf.WriteString(q.having)
+	buf.WriteString(q.order)
+
+	if withLimit {
+		buf.WriteString(" LIMIT ")
+		buf.WriteString(strconv.FormatInt(q.offset, 10))
+		buf.WriteByte(',')
+		buf.WriteString(strconv.FormatInt(q.limit, 10))
+	}
+
+	return args
+}
+
+func writeTable(buf *bytes.Buffer, args []interface{}, table string, subQuery *Query, alias string) []interface{} {
+	if subQuery != nil {
+		buf.WriteByte('(')
+		args = subQuery.build(buf, args, subQuery.limited)
+		buf.WriteByte(')')
+	} else {
+		buf.WriteString(table)
+	}
+
+	if alias != "" {
+		buf.WriteString(" AS ")
+		buf.WriteString(alias)
+	}
+	return args
+}
+
+func buildInsertByMap(table string, rows ...map[string]interface{}) (sql string, arguments []interface{}, err error) {
+	return buildInsert(insertVerb, table, rows)
+}
+
+func buildReplaceByMap(table string, rows ...map[string]interface{}) (sql string, arguments []interface{}, err error) {
+	return buildInsert(replaceVerb, table, rows)
+}
+
+// buildUpsert keys为冲突检测字段，MySQL仅用于排除默认更新字段；updateColumns为空时更新除keys外的所有插入字段
+func buildUpsert(dialect Dialect, table string, keys []string, updateColumns []string, rows ...map[string]interface{}) (sql string, arguments []interface{}, err error) {
+	if len(rows) < 1 {
+		return "", nil, nil
+	}
+
+	if keys, err = quoteNames(keys); err != nil {
+		return "", nil, err
+	}
+
+	if len(updateColumns) > 0 {
+		if updateColumns, err = quoteNames(updateColumns); err != nil {
+			return "", nil, err
+		}
+	} else if updateColumns, err = defaultUpdateColumns(rows[0], keys); err != nil {
+		return "", nil, err
+	}
 
-	condition, args := buildWhere(q.where)
-	if len(condition) > 0 {
-		where = string(condition)
+	clause, err := dialect.Upsert(keys, updateColumns)
+	if err != nil {
+		return "", nil, err
 	}
 
-	return "SELECT " + q.columns + " FROM " + q.table + where + q.group + q.having + q.order + " LIMIT " + strconv.FormatInt(q.offset, 10) + "," + strconv.FormatInt(q.limit, 10), args
+	sql, arguments, err = buildInsert(insertVerb, table, rows)
+	if err != nil || sql == "" {
+		return sql, arguments, err
+	}
+	return sql + clause, arguments, nil
 }
 
-func buildInsertByMap(table string, rows ...map[string]interface{}) (sql string, arguments []interface{}) {
-	if len(rows) < 0 {
-		return "", nil
+// defaultUpdateColumns 除keys外的所有插入字段，只有keys时使用keys，保证语句合法
+func defaultUpdateColumns(row map[string]interface{}, keys []string) ([]string, error) {
+	columns, err := quoteNames(sortedKeys(row))
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		excluded[key] = true
+	}
+
+	updateColumns := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !excluded[column] {
+			updateColumns = append(updateColumns, column)
+		}
+	}
+
+	if len(updateColumns) == 0 {
+		return columns, nil
+	}
+	return updateColumns, nil
+}
+
+// buildInsert 字段会校验并以反引号引用
+func buildInsert(verb string, table string, rows []map[string]interface{}) (sql string, arguments []interface{}, err error) {
+	if len(rows) < 1 {
+		return "", nil, nil
+	}
+
+	var (
+		row         = rows[0]
+		dbFieldList = sortedKeys(row)
+	)
+
+	quotedList, err := quoteNames(dbFieldList)
+	if err != nil {
+		return "", nil, err
 	}
 
 	var (
-		row       = rows[0]
 		sqlBuffer = bytes.NewBuffer(nil)
 		args      []interface{}
 	)
@@ -200,31 +502,26 @@ func buildInsertByMap(table string, rows ...map[string]interface{}) (sql string,
 		args = make([]interface{}, 0, len(rows)*len(row))
 	}
 
-	var (
-		dbFieldList = make([]string, 0, len(rows))
-		v           = make([]byte, 0, 2*len(rows))
-	)
-
-	for field, value := range row {
+	v := make([]byte, 0, 2*len(row))
+	for index, field := range dbFieldList {
 		if len(args) > 0 {
 			v = append(v, ',')
 			sqlBuffer.WriteByte(',')
 		} else {
 			v = append(v, '(')
-			sqlBuffer.WriteString("INSERT INTO ")
+			sqlBuffer.WriteString(verb)
 			sqlBuffer.WriteString(table)
 			sqlBuffer.WriteByte('(')
 		}
 
-		dbFieldList = append(dbFieldList, field)
 		v = append(v, '?')
-		sqlBuffer.WriteString(field)
-		args = append(args, value)
+		sqlBuffer.WriteString(quotedList[index])
+		args = append(args, row[field])
 	}
 
 	//没有找到字段
 	if len(args) < 1 {
-		return "", args
+		return "", args, nil
 	}
 
 	sqlBuffer.WriteByte(')')
@@ -243,44 +540,57 @@ func buildInsertByMap(table string, rows ...map[string]interface{}) (sql string,
 		}
 	}
 
-	return sqlBuffer.String(), args
+	return sqlBuffer.String(), args, nil
 }
 
-func buildUpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (sql string, arguments []interface{}) {
+// buildUpdateAll set及where的字段会校验并以反引号引用
+func buildUpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (sql string, arguments []interface{}, err error) {
+	condition, params, err := buildWhere(MapCondition(where))
+	if err != nil {
+		return "", nil, err
+	}
+
 	sqlBuffer := bytes.NewBufferString(fmt.Sprintf("UPDATE %s SET ", table))
 	args := boot.AcquireArgs()
-	var num = 0
-	for field, arg := range set {
-		if num > 0 {
+	for index, field := range sortedKeys(set) {
+		quoted, err := QuoteIdentifier(field)
+		if err != nil {
+			boot.ReleaseArgs(&args)
+			return "", nil, err
+		}
+
+		if index > 0 {
 			sqlBuffer.WriteByte(',')
-		} else {
-			num++
 		}
-		sqlBuffer.Write([]byte(field))
+		sqlBuffer.WriteString(quoted)
 		sqlBuffer.Write([]byte("=?"))
-		args = append(args, arg)
+		args = append(args, set[field])
 	}
 
-	if len(where) > 0 {
-		condition, params := buildWhere(where)
-		sqlBuffer.Write(condition)
-		args = append(args, params...)
-	}
-
-	return sqlBuffer.String(), args
+	sqlBuffer.Write(condition)
+	args = append(args, params...)
+	return sqlBuffer.String(), args, nil
 }
 
-func buildDeleteAll(table string, where map[string]interface{}) (sql string, arguments []interface{}) {
+func buildDeleteAll(table string, where map[string]interface{}) (sql string, arguments []interface{}, err error) {
+	condition, args, err := buildWhere(MapCondition(where))
+	if err != nil {
+		return "", nil, err
+	}
+
 	sqlBuffer := bytes.NewBufferString("DELETE FROM ")
 	sqlBuffer.Write([]byte(table))
+	sqlBuffer.Write(condition)
+	return sqlBuffer.String(), args, nil
+}
 
-	if len(where) > 0 {
-		condition, args := buildWhere(where)
-
-		sqlBuffer.Write(condition)
-		return sqlBuffer.String(), args
+func sortedKeys(row map[string]interface{}) []string {
+	keys := make([]string, 0, len(row))
+	for key, _ := range row {
+		keys = append(keys, key)
 	}
-	return sqlBuffer.String(), nil
+	sort.Strings(keys)
+	return keys
 }
 
 type RowFormat func(fieldValue map[string][]byte)
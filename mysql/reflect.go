@@ -3,10 +3,13 @@ package mysql
 import (
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/grpc-boot/boot"
 )
@@ -15,6 +18,14 @@ const (
 	tagName  = `bdb`
 	required = `required`
 	primary  = `primary`
+	version  = `version`
+)
+
+const (
+	createdAt = `created_at`
+	updatedAt = `updated_at`
+	deletedAt = `deleted_at`
+	jsonField = `json`
 )
 
 const (
@@ -26,18 +37,179 @@ var (
 	ErrNotFoundField        = errors.New(`failed to match the field from the struct to the database. Please configure the bdb tag correctly`)
 	ErrNotFoundPrimaryField = errors.New(`failed to found primary field. Please configure the primary on bdb tag correctly`)
 	ErrInvalidTypes         = errors.New(`only *struct types are supported`)
-	ErrInvalidFieldTypes    = errors.New(`only bool(1 is true, other is false),string、float64、float32、int、uint、int8、uint8、int16、uint16、int32、uint32、int64 and uint64 types are supported`)
+	ErrInvalidSliceTypes    = errors.New(`only *[]struct and *[]*struct types are supported`)
+	ErrVersionConflict      = errors.New(`the row has been modified or deleted by another writer, the version does not match`)
+	ErrInvalidFieldTypes    = errors.New(`only bool(1 and true literals such as true、TRUE、t are true, other is false),string、numeric、[]byte、time.Time、sql.Scanner、pointers to them and json tagged fields are supported`)
 )
 
+// TableName 定义了TableName方法时使用value调用，否则为小写的类型名
 func TableName(value reflect.Value) (tableName string) {
-	v := value.MethodByName(tableMethod)
-	if v.Kind() == reflect.Func {
-		return v.Call(nil)[0].String()
+	t := value.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return strings.ToLower(t.Name())
+	}
+	return getModelMeta(t).tableName(value)
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+	scannerType  = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType   = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// timeLayouts 驱动未开启parseTime时返回的时间格式，开启后database/sql会以RFC3339Nano格式转为[]byte
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+// modelType 解析obj的结构体类型，支持struct、*struct、[]struct、*[]struct和*[]*struct
+func modelType(obj interface{}) reflect.Type {
+	t := reflect.TypeOf(obj)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// softDeleteCondition 整型字段以0表示未删除，其他类型以NULL表示未删除
+func softDeleteCondition(t reflect.Type, alias string) Condition {
+	field := getModelMeta(t).deleted
+	if field == nil {
+		return nil
+	}
+
+	column := field.quoted
+	if alias != "" {
+		column = alias + "." + column
+	}
+
+	switch t.Field(field.index).Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Eq(column, 0)
+	}
+	return IsNull(column)
+}
+
+// setTimestamp 整型字段填充unix时间戳(秒)，time.Time和*time.Time字段填充now
+func setTimestamp(field reflect.Value, now time.Time) bool {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(now.Unix())
+		return true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(now.Unix()))
+		return true
+	case reflect.Struct:
+		switch field.Type() {
+		case timeType:
+			field.Set(reflect.ValueOf(now))
+			return true
+		case nullTimeType:
+			field.Set(reflect.ValueOf(sql.NullTime{Time: now, Valid: true}))
+			return true
+		}
+	case reflect.Ptr:
+		if field.Type().Elem() == timeType {
+			field.Set(reflect.ValueOf(&now))
+			return true
+		}
 	}
-	return strings.ToLower(v.Type().Name())
+	return false
+}
+
+// settable 对象不可修改时(非指针传入)返回其副本
+func settable(value reflect.Value) reflect.Value {
+	if value.CanSet() {
+		return value
+	}
+
+	v := reflect.New(value.Type()).Elem()
+	v.Set(value)
+	return v
+}
+
+// fillTimestamps 插入时填充为零值的created_at和updated_at字段，更新时总是填充updated_at字段
+func fillTimestamps(value reflect.Value, isInsert bool, now time.Time) reflect.Value {
+	meta := getModelMeta(value.Type())
+	if !meta.timestamp {
+		return value
+	}
+
+	for _, field := range meta.fields {
+		isZero := value.Field(field.index).IsZero()
+		fill := field.updatedAt && (!isInsert || isZero)
+		if isInsert && field.createdAt && isZero {
+			fill = true
+		}
+
+		if !fill {
+			continue
+		}
+
+		value = settable(value)
+		setTimestamp(value.Field(field.index), now)
+	}
+	return value
 }
 
 func BuildInsertByObj(rows interface{}) (sql string, args []interface{}, err error) {
+	sql, args, _, err = buildInsertByObj(insertVerb, rows)
+	return
+}
+
+func BuildReplaceByObj(rows interface{}) (sql string, args []interface{}, err error) {
+	sql, args, _, err = buildInsertByObj(replaceVerb, rows)
+	return
+}
+
+// BuildUpsertByObj 生成INSERT ... ON DUPLICATE KEY UPDATE语句，updateColumns为空时更新除主键外的所有插入字段
+func BuildUpsertByObj(rows interface{}, updateColumns ...string) (sql string, args []interface{}, err error) {
+	return buildUpsertByObj(MysqlDialect{}, rows, updateColumns)
+}
+
+// buildUpsertByObj 以主键作为冲突检测字段
+func buildUpsertByObj(dialect Dialect, rows interface{}, updateColumns []string) (sql string, args []interface{}, err error) {
+	sql, args, columns, err := buildInsertByObj(insertVerb, rows)
+	if err != nil {
+		return
+	}
+
+	if len(updateColumns) == 0 {
+		updateColumns = columns
+	} else if updateColumns, err = quoteNames(updateColumns); err != nil {
+		boot.ReleaseArgs(&args)
+		return "", nil, err
+	}
+
+	var keys []string
+	if t := modelType(rows); t != nil {
+		for _, field := range getModelMeta(t).primaries {
+			keys = append(keys, field.quoted)
+		}
+	}
+
+	clause, err := dialect.Upsert(keys, updateColumns)
+	if err != nil {
+		boot.ReleaseArgs(&args)
+		return "", nil, err
+	}
+	return sql + clause, args, nil
+}
+
+func buildInsertByObj(verb string, rows interface{}) (sql string, args []interface{}, updateColumns []string, err error) {
 	var (
 		vRows  = reflect.ValueOf(rows)
 		values []reflect.Value
@@ -52,80 +224,85 @@ func BuildInsertByObj(rows interface{}) (sql string, args []interface{}, err err
 	case reflect.Slice:
 		values = make([]reflect.Value, 0, vRows.Len())
 		for i := 0; i < vRows.Len(); i++ {
-			values = append(values, vRows.Index(i))
+			elem := vRows.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+
+			if elem.Kind() != reflect.Struct {
+				return "", nil, nil, ErrInvalidRowsTypes
+			}
+			values = append(values, elem)
 		}
 	case reflect.Struct:
 		values = []reflect.Value{vRows}
 	default:
-		return "", nil, ErrInvalidRowsTypes
+		return "", nil, nil, ErrInvalidRowsTypes
+	}
+
+	if len(values) < 1 {
+		return "", nil, nil, ErrNotFoundField
+	}
+
+	now := time.Now()
+	for index := range values {
+		values[index] = fillTimestamps(values[index], true, now)
 	}
 
 	var (
-		value      = values[0]
-		sqlBuffer  = bytes.NewBuffer(nil)
-		t          = value.Type()
-		fieldCount = t.NumField()
+		value     = values[0]
+		meta      = getModelMeta(value.Type())
+		sqlBuffer = bytes.NewBuffer(nil)
+		fields    = make([]*fieldMeta, 0, len(meta.fields))
+		v         = make([]byte, 0, 2*len(meta.fields))
 	)
 
+	table, err := meta.quotedTable(value)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
 	if len(values) == 1 {
 		args = boot.AcquireArgs()
 	} else {
-		args = make([]interface{}, 0, len(values)*fieldCount)
+		args = make([]interface{}, 0, len(values)*len(meta.fields))
 	}
 
-	var (
-		dbFieldList  = make([]string, 0, len(values))
-		dbFieldCount int
-		dbField      string
-		isRequired   bool
-		v            = make([]byte, 0, 2*fieldCount)
-	)
-
 	//寻找数据库字段和值
-	for i := 0; i < fieldCount; i++ {
-		dbField = t.Field(i).Tag.Get(tagName)
-		isRequired = false
-
-		if dbField == "" {
+	for _, field := range meta.fields {
+		fieldValue := value.Field(field.index)
+		if !field.required && fieldValue.IsZero() {
 			continue
 		}
 
-		tags := strings.Split(dbField, ",")
-		dbField = tags[0]
-		for _, val := range tags {
-			if val == required {
-				isRequired = true
-				break
-			}
-		}
-
-		if !isRequired && value.Field(i).IsZero() {
-			continue
+		if !field.primary {
+			updateColumns = append(updateColumns, field.quoted)
 		}
 
-		dbFieldCount++
-		dbFieldList = append(dbFieldList, t.Field(i).Name)
+		fields = append(fields, field)
 
 		if len(args) > 0 {
 			v = append(v, ',')
 			sqlBuffer.WriteByte(',')
 		} else {
 			v = append(v, '(')
-			sqlBuffer.WriteString("INSERT INTO ")
-			sqlBuffer.WriteString(TableName(value))
+			sqlBuffer.WriteString(verb)
+			sqlBuffer.WriteString(table)
 			sqlBuffer.WriteByte('(')
 		}
 
 		v = append(v, '?')
-		sqlBuffer.WriteByte('`')
-		sqlBuffer.WriteString(dbField)
-		sqlBuffer.WriteByte('`')
-		args = append(args, value.Field(i).Interface())
+		sqlBuffer.WriteString(field.quoted)
+		arg, err := fieldArg(fieldValue, field.json)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		args = append(args, arg)
 	}
 
 	//没有找到字段
 	if len(args) < 1 {
-		return "", args, ErrNotFoundField
+		return "", args, nil, ErrNotFoundField
 	}
 
 	sqlBuffer.WriteByte(')')
@@ -138,15 +315,20 @@ func BuildInsertByObj(rows interface{}) (sql string, args []interface{}, err err
 		for start := 1; start < len(values); start++ {
 			sqlBuffer.WriteByte(',')
 			sqlBuffer.Write(v)
-			for _, fieldName := range dbFieldList {
-				args = append(args, values[start].FieldByName(fieldName).Interface())
+			for _, field := range fields {
+				arg, err := fieldArg(values[start].Field(field.index), field.json)
+				if err != nil {
+					return "", nil, nil, err
+				}
+				args = append(args, arg)
 			}
 		}
 	}
 
-	return sqlBuffer.String(), args, nil
+	return sqlBuffer.String(), args, updateColumns, nil
 }
 
+// BuildDeleteByObj 带deleted_at标签时生成软删除的UPDATE语句，并同步对象中的删除时间
 func BuildDeleteByObj(obj interface{}) (sqlStr string, args []interface{}, err error) {
 	var (
 		value     = reflect.ValueOf(obj)
@@ -161,54 +343,81 @@ func BuildDeleteByObj(obj interface{}) (sqlStr string, args []interface{}, err e
 		return
 	}
 
-	var (
-		t          = value.Type()
-		fieldCount = value.NumField()
+	meta := getModelMeta(value.Type())
 
-		dbField   string
-		isPrimary bool
-		where     = make(map[string]interface{}, 2)
-	)
+	//没有找到主键
+	if len(meta.primaries) < 1 {
+		return "", nil, ErrNotFoundPrimaryField
+	}
 
-	//寻找数据库字段和值
-	for i := 0; i < fieldCount; i++ {
-		dbField = t.Field(i).Tag.Get(tagName)
-		isPrimary = false
+	table, err := meta.quotedTable(value)
+	if err != nil {
+		return "", nil, err
+	}
 
-		if dbField == "" {
-			continue
+	where := make(map[string]interface{}, len(meta.primaries))
+	for _, field := range meta.primaries {
+		where[field.quoted] = value.Field(field.index).Interface()
+	}
+
+	//软删除：更新deleted_at字段，同时更新updated_at字段
+	if field := meta.deleted; field != nil {
+		now := time.Now()
+		value = settable(value)
+		if !setTimestamp(value.Field(field.index), now) {
+			return "", nil, ErrInvalidFieldTypes
 		}
 
-		tags := strings.Split(dbField, ",")
-		dbField = "`" + tags[0] + "`"
-		for _, val := range tags {
-			if strings.TrimSpace(val) == primary {
-				isPrimary = true
-			}
+		whereBytes, a, err := buildWhere(MapCondition(where))
+		if err != nil {
+			return "", nil, err
 		}
 
-		if isPrimary {
-			where[dbField] = value.Field(i).Interface()
-			continue
+		sqlBuffer.WriteString("UPDATE ")
+		sqlBuffer.WriteString(table)
+		sqlBuffer.WriteString(" SET ")
+		sqlBuffer.WriteString(field.quoted)
+		sqlBuffer.WriteString("=?")
+		args = []interface{}{value.Field(field.index).Interface()}
+
+		for _, updated := range meta.fields {
+			if !updated.updatedAt || updated == field {
+				continue
+			}
+
+			if !setTimestamp(value.Field(updated.index), now) {
+				return "", nil, ErrInvalidFieldTypes
+			}
+
+			sqlBuffer.WriteByte(',')
+			sqlBuffer.WriteString(updated.quoted)
+			sqlBuffer.WriteString("=?")
+			args = append(args, value.Field(updated.index).Interface())
 		}
+		sqlBuffer.Write(whereBytes)
+
+		return sqlBuffer.String(), append(args, a...), nil
 	}
 
-	//没有找到主键
-	if len(where) < 1 {
-		return "", nil, ErrNotFoundPrimaryField
+	whereBytes, a, err := buildWhere(MapCondition(where))
+	if err != nil {
+		return "", nil, err
 	}
 
-	whereBytes, a := buildWhere(where)
 	sqlBuffer.WriteString("DELETE FROM ")
-	sqlBuffer.WriteByte('`')
-	sqlBuffer.WriteString(TableName(value))
-	sqlBuffer.WriteByte('`')
+	sqlBuffer.WriteString(table)
 	sqlBuffer.Write(whereBytes)
 
 	return sqlBuffer.String(), a, nil
 }
 
 func BuildUpdateByObj(obj interface{}) (sqlStr string, args []interface{}, err error) {
+	sqlStr, args, _, err = buildUpdateByObj(obj)
+	return
+}
+
+// buildUpdateByObj versionField为带version标签的字段，不存在时无效
+func buildUpdateByObj(obj interface{}) (sqlStr string, args []interface{}, versionField reflect.Value, err error) {
 	var (
 		value     = reflect.ValueOf(obj)
 		sqlBuffer = bytes.NewBuffer(nil)
@@ -222,72 +431,100 @@ func BuildUpdateByObj(obj interface{}) (sqlStr string, args []interface{}, err e
 		return
 	}
 
-	args = boot.AcquireArgs()
+	value = fillTimestamps(value, false, time.Now())
 
 	var (
-		t          = value.Type()
-		fieldCount = value.NumField()
-
-		dbField    string
-		isRequired bool
-		isPrimary  bool
-		where      = make(map[string]interface{}, 2)
+		meta     = getModelMeta(value.Type())
+		setCount int
+		where    = make(map[string]interface{}, 2)
 	)
 
-	//寻找数据库字段和值
-	for i := 0; i < fieldCount; i++ {
-		dbField = t.Field(i).Tag.Get(tagName)
-		isRequired = false
-		isPrimary = false
+	table, err := meta.quotedTable(value)
+	if err != nil {
+		return "", nil, versionField, err
+	}
 
-		if dbField == "" {
-			continue
-		}
+	args = boot.AcquireArgs()
 
-		tags := strings.Split(dbField, ",")
-		dbField = tags[0]
-		for _, val := range tags {
-			switch strings.TrimSpace(val) {
-			case required:
-				isRequired = true
-			case primary:
-				isPrimary = true
-			}
+	//寻找数据库字段和值
+	for _, field := range meta.fields {
+		fieldValue := value.Field(field.index)
+		if field.primary {
+			where[field.column] = fieldValue.Interface()
+			continue
 		}
 
-		if isPrimary {
-			where[dbField] = value.Field(i).Interface()
+		//创建时间不随更新修改
+		if field.createdAt {
 			continue
 		}
 
-		if !isRequired && value.Field(i).IsZero() {
+		if !field.version && !field.required && fieldValue.IsZero() {
 			continue
 		}
 
-		if len(args) > 0 {
+		if setCount > 0 {
 			sqlBuffer.WriteByte(',')
 		} else {
 			sqlBuffer.WriteString("UPDATE ")
-			sqlBuffer.WriteString(TableName(value))
+			sqlBuffer.WriteString(table)
 			sqlBuffer.WriteString(" SET ")
 		}
+		setCount++
+
+		sqlBuffer.WriteString(field.quoted)
+
+		//乐观锁：以当前版本号为条件，并将版本号加1
+		if field.version {
+			sqlBuffer.WriteString("=")
+			sqlBuffer.WriteString(field.quoted)
+			sqlBuffer.WriteString("+1")
+			where[field.column] = fieldValue.Interface()
+			versionField = fieldValue
+			continue
+		}
+
+		arg, err := fieldArg(fieldValue, field.json)
+		if err != nil {
+			return "", nil, versionField, err
+		}
 
-		sqlBuffer.WriteByte('`')
-		sqlBuffer.WriteString(dbField)
-		sqlBuffer.WriteByte('`')
 		sqlBuffer.WriteString("=?")
-		args = append(args, value.Field(i).Interface())
+		args = append(args, arg)
 	}
 
 	//没有找到主键
-	if len(where) < 1 {
-		return "", nil, ErrNotFoundPrimaryField
+	if len(where) < 1 || (versionField.IsValid() && len(where) < 2) {
+		return "", nil, versionField, ErrNotFoundPrimaryField
+	}
+
+	//没有需要更新的字段
+	if setCount < 1 {
+		return "", nil, versionField, ErrNotFoundField
+	}
+
+	whereBytes, a, err := buildWhere(MapCondition(where))
+	if err != nil {
+		return "", nil, versionField, err
 	}
 
-	whereBytes, a := buildWhere(where)
 	sqlBuffer.Write(whereBytes)
 	args = append(args, a...)
-	return sqlBuffer.String(), args, nil
+	return sqlBuffer.String(), args, versionField, nil
+}
+
+// incrVersion 更新成功后同步对象中的版本号，obj为非指针时无法修改
+func incrVersion(versionField reflect.Value) {
+	if !versionField.IsValid() || !versionField.CanSet() {
+		return
+	}
+
+	switch versionField.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		versionField.SetInt(versionField.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		versionField.SetUint(versionField.Uint() + 1)
+	}
 }
 
 func Row2Obj(rows *sql.Rows, obj interface{}) error {
@@ -331,49 +568,211 @@ func Row2Obj(rows *sql.Rows, obj interface{}) error {
 		return ErrInvalidTypes
 	}
 
+	for _, field := range getModelMeta(v.Type()).fields {
+		value, exists := row[field.column]
+		if !exists {
+			continue
+		}
+
+		if err = setField(v.Field(field.index), value, field.json); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rows2Objs 将结果集填充到dest中，dest为*[]struct或*[]*struct
+// 结果集中未映射到bdb标签的列会被忽略，NULL值会被填充为字段类型的零值
+func Rows2Objs(rows *sql.Rows, dest interface{}) error {
+	defer rows.Close()
+
+	sliceValue := reflect.ValueOf(dest)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice {
+		return ErrInvalidSliceTypes
+	}
+	sliceValue = sliceValue.Elem()
+
 	var (
-		fieldCount = v.NumField()
+		elemType = sliceValue.Type().Elem()
+		isPtr    = elemType.Kind() == reflect.Ptr
 	)
 
-	if fieldCount < 1 {
-		return nil
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	if elemType.Kind() != reflect.Struct {
+		return ErrInvalidSliceTypes
+	}
+
+	fields, err := rows.Columns()
+	if err != nil {
+		return err
 	}
 
 	var (
-		t = v.Type()
+		meta      = getModelMeta(elemType)
+		fieldList = make([]*fieldMeta, len(fields), len(fields))
+		values    = make([]interface{}, len(fields), len(fields))
+		list      = reflect.MakeSlice(sliceValue.Type(), 0, 8)
 	)
 
-	for i := 0; i < fieldCount; i++ {
-		tag := t.Field(i).Tag.Get(tagName)
-		if tag == "" {
-			continue
-		}
+	for index, field := range fields {
+		values[index] = &[]byte{}
+		fieldList[index] = meta.columns[field]
+	}
 
-		fieldName := strings.Split(tag, ",")[0]
-		if _, exists := row[fieldName]; !exists {
-			continue
+	for rows.Next() {
+		err = rows.Scan(values...)
+		if err != nil {
+			return err
 		}
 
-		switch v.Field(i).Kind() {
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			v.Field(i).SetInt(boot.Bytes2Int64(row[fieldName]))
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			v.Field(i).SetUint(boot.Bytes2Uint64(row[fieldName]))
-		case reflect.String:
-			v.Field(i).SetString(string(row[fieldName]))
-		case reflect.Float32, reflect.Float64:
-			var val float64
-			val, err = strconv.ParseFloat(string(row[fieldName]), 64)
-			if err != nil {
+		elem := reflect.New(elemType).Elem()
+		for index, field := range fieldList {
+			if field == nil {
 				continue
 			}
-			v.Field(i).SetFloat(val)
-		case reflect.Bool:
-			v.Field(i).SetBool(string(row[fieldName]) == "1")
-		default:
+
+			if err = setField(elem.Field(field.index), *values[index].(*[]byte), field.json); err != nil {
+				return err
+			}
+		}
+
+		if isPtr {
+			list = reflect.Append(list, elem.Addr())
+		} else {
+			list = reflect.Append(list, elem)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	sliceValue.Set(list)
+	return nil
+}
+
+// fieldArg 返回写入数据库的参数，time.Time、[]byte、指针及driver.Valuer由驱动处理，json标签字段序列化为JSON字符串
+func fieldArg(field reflect.Value, isJson bool) (interface{}, error) {
+	if !isJson {
+		//指针接收者实现的driver.Valuer
+		if !field.Type().Implements(valuerType) && field.CanAddr() && field.Addr().Type().Implements(valuerType) {
+			return field.Addr().Interface(), nil
+		}
+		return field.Interface(), nil
+	}
+
+	switch field.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		if field.IsNil() {
+			return nil, nil
+		}
+	}
+
+	data, err := json.Marshal(field.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// setField value为nil时表示NULL，sql.Scanner类型交由Scan处理，其他类型NULL值填充为零值
+func setField(field reflect.Value, value []byte, isJson bool) error {
+	if isJson {
+		if value == nil {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		return json.Unmarshal(value, field.Addr().Interface())
+	}
+
+	//sql.NullTime.Scan不支持[]byte
+	if field.Type() == nullTimeType {
+		if value == nil {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+
+		t, err := parseTime(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(sql.NullTime{Time: t, Valid: !t.IsZero()}))
+		return nil
+	}
+
+	if field.Kind() != reflect.Ptr && field.Addr().Type().Implements(scannerType) {
+		var src interface{}
+		if value != nil {
+			src = value
+		}
+		return field.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+
+	//NULL值
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := setField(elem.Elem(), value, false); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.Struct:
+		if field.Type() != timeType {
 			return ErrInvalidFieldTypes
 		}
+
+		t, err := parseTime(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return ErrInvalidFieldTypes
+		}
+		field.SetBytes(append([]byte{}, value...))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(boot.Bytes2Int64(value))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(boot.Bytes2Uint64(value))
+	case reflect.String:
+		field.SetString(string(value))
+	case reflect.Float32, reflect.Float64:
+		val, err := strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return nil
+		}
+		field.SetFloat(val)
+	case reflect.Bool:
+		b, _ := strconv.ParseBool(string(value))
+		field.SetBool(b)
+	default:
+		return ErrInvalidFieldTypes
 	}
 
 	return nil
 }
+
+// parseTime 零值时间如0000-00-00 00:00:00解析为time.Time{}
+func parseTime(value []byte) (t time.Time, err error) {
+	str := string(value)
+	if strings.HasPrefix(str, "0000-00-00") {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err = time.ParseInLocation(layout, str, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
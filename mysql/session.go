@@ -0,0 +1,44 @@
+package mysql
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type sessionKey struct{}
+
+// Session 记录最近一次写入时间，配合GroupOption.StickyInterval实现写后读主库
+type Session struct {
+	lastWrite int64
+}
+
+func NewSession() *Session {
+	return &Session{}
+}
+
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+func (s *Session) MarkWrite() {
+	atomic.StoreInt64(&s.lastWrite, time.Now().UnixNano())
+}
+
+func (s *Session) LastWrite() time.Time {
+	lastWrite := atomic.LoadInt64(&s.lastWrite)
+	if lastWrite == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastWrite)
+}
+
+func (s *Session) Sticky(interval time.Duration) bool {
+	lastWrite := atomic.LoadInt64(&s.lastWrite)
+	return lastWrite > 0 && time.Now().UnixNano()-lastWrite < int64(interval)
+}
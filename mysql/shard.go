@@ -0,0 +1,283 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+
+	"github.com/grpc-boot/boot"
+	"github.com/grpc-boot/boot/hash"
+)
+
+const (
+	defaultTableFormat = "%s_%02d"
+)
+
+var (
+	ErrShardGroups        = errors.New("mysql shard: at least one group is required")
+	ErrShardTableCount    = errors.New("mysql shard: tableCount must be greater than or equal to the number of groups")
+	ErrShardKeyOutOfRange = errors.New("mysql shard: shard key out of range")
+	ErrShardKeyType       = errors.New("mysql shard: range strategy only supports integer shard keys")
+)
+
+type ShardOption struct {
+	//逻辑表名，如：user
+	Table string `yaml:"table" json:"table"`
+	//物理表总数，按顺序均匀分布到各个Group
+	TableCount int `yaml:"tableCount" json:"tableCount"`
+	//物理表名格式，默认为"%s_%02d"，如：user_00
+	TableFormat string `yaml:"tableFormat" json:"tableFormat"`
+}
+
+// ShardStrategy 根据分片键计算物理表下标，取值范围为[0, tableCount)
+type ShardStrategy interface {
+	Slot(key interface{}, tableCount int) (slot int, err error)
+}
+
+type ModStrategy struct{}
+
+func (m ModStrategy) Slot(key interface{}, tableCount int) (slot int, err error) {
+	if number, ok := shardNumber(key); ok {
+		return int(uint64(number) % uint64(tableCount)), nil
+	}
+	return int(boot.HashOrNumber(key) % uint32(tableCount)), nil
+}
+
+// RangeStrategy Bounds[i]为第i张表分片键的上界(不含)，需按升序排列
+type RangeStrategy struct {
+	Bounds []int64
+}
+
+func (r RangeStrategy) Slot(key interface{}, tableCount int) (slot int, err error) {
+	number, ok := shardNumber(key)
+	if !ok {
+		return 0, ErrShardKeyType
+	}
+
+	slot = sort.Search(len(r.Bounds), func(i int) bool {
+		return number < r.Bounds[i]
+	})
+
+	if slot >= len(r.Bounds) || slot >= tableCount {
+		return 0, ErrShardKeyOutOfRange
+	}
+	return slot, nil
+}
+
+type ShardNode int
+
+func (s ShardNode) HashCode() (hashValue uint32) {
+	return crc32.ChecksumIEEE([]byte("shard:" + strconv.Itoa(int(s))))
+}
+
+// RingStrategy 一致性哈希，ring中的节点须为ShardNode
+type RingStrategy struct {
+	ring hash.Ring
+}
+
+func NewRingStrategy(tableCount int) *RingStrategy {
+	servers := make([]boot.CanHash, tableCount, tableCount)
+	for index := 0; index < tableCount; index++ {
+		servers[index] = ShardNode(index)
+	}
+
+	return &RingStrategy{
+		ring: hash.NewDefaultRing(servers),
+	}
+}
+
+func NewRingStrategyWithRing(ring hash.Ring) *RingStrategy {
+	return &RingStrategy{
+		ring: ring,
+	}
+}
+
+func (r *RingStrategy) Slot(key interface{}, tableCount int) (slot int, err error) {
+	server, err := r.ring.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	slot = int(server.(ShardNode))
+	if slot >= tableCount {
+		return 0, ErrShardKeyOutOfRange
+	}
+	return slot, nil
+}
+
+func shardNumber(key interface{}) (number int64, ok bool) {
+	switch val := key.(type) {
+	case int:
+		return int64(val), true
+	case int8:
+		return int64(val), true
+	case int16:
+		return int64(val), true
+	case int32:
+		return int64(val), true
+	case int64:
+		return val, true
+	case uint:
+		return int64(val), true
+	case uint8:
+		return int64(val), true
+	case uint16:
+		return int64(val), true
+	case uint32:
+		return int64(val), true
+	case uint64:
+		return int64(val), true
+	}
+	return 0, false
+}
+
+type ShardRouter struct {
+	groups      []*Group
+	table       string
+	tableCount  int
+	tableFormat string
+	strategy    ShardStrategy
+}
+
+func NewShardRouter(option *ShardOption, groups []*Group, strategy ShardStrategy) (*ShardRouter, error) {
+	if len(groups) < 1 {
+		return nil, ErrShardGroups
+	}
+
+	if option.TableCount < len(groups) {
+		return nil, ErrShardTableCount
+	}
+
+	router := &ShardRouter{
+		groups:      groups,
+		table:       option.Table,
+		tableCount:  option.TableCount,
+		tableFormat: option.TableFormat,
+		strategy:    strategy,
+	}
+
+	if router.tableFormat == "" {
+		router.tableFormat = defaultTableFormat
+	}
+
+	if router.strategy == nil {
+		router.strategy = ModStrategy{}
+	}
+
+	return router, nil
+}
+
+func (r *ShardRouter) TableName(slot int) string {
+	return fmt.Sprintf(r.tableFormat, r.table, slot)
+}
+
+func (r *ShardRouter) Locate(key interface{}) (shard *Shard, err error) {
+	slot, err := r.strategy.Slot(key, r.tableCount)
+	if err != nil {
+		return nil, err
+	}
+
+	dbIndex := slot * len(r.groups) / r.tableCount
+	return &Shard{
+		Group:      r.groups[dbIndex],
+		Table:      r.TableName(slot),
+		DbIndex:    dbIndex,
+		TableIndex: slot,
+	}, nil
+}
+
+// Range 遍历所有物理表，handler返回true时停止
+func (r *ShardRouter) Range(handler func(shard *Shard) (handled bool)) {
+	for slot := 0; slot < r.tableCount; slot++ {
+		dbIndex := slot * len(r.groups) / r.tableCount
+		shard := &Shard{
+			Group:      r.groups[dbIndex],
+			Table:      r.TableName(slot),
+			DbIndex:    dbIndex,
+			TableIndex: slot,
+		}
+
+		if handler(shard) {
+			break
+		}
+	}
+}
+
+type Shard struct {
+	Group      *Group
+	Table      string
+	DbIndex    int
+	TableIndex int
+}
+
+func (s *Shard) Find(query *Query, useMaster bool) (*sql.Rows, error) {
+	return s.FindContext(context.Background(), query, useMaster)
+}
+
+func (s *Shard) FindContext(ctx context.Context, query *Query, useMaster bool) (*sql.Rows, error) {
+	return s.Group.FindContext(ctx, query.From(s.Table), useMaster)
+}
+
+func (s *Shard) FindOne(obj interface{}, query *Query, useMaster bool) error {
+	return s.FindOneContext(context.Background(), obj, query, useMaster)
+}
+
+func (s *Shard) FindOneContext(ctx context.Context, obj interface{}, query *Query, useMaster bool) error {
+	return s.Group.FindOneContext(ctx, obj, query.From(s.Table), useMaster)
+}
+
+func (s *Shard) FindAll(query *Query, dest interface{}, useMaster bool) error {
+	return s.FindAllContext(context.Background(), query, dest, useMaster)
+}
+
+func (s *Shard) FindAllContext(ctx context.Context, query *Query, dest interface{}, useMaster bool) error {
+	return s.Group.FindAllContext(ctx, query.From(s.Table), dest, useMaster)
+}
+
+func (s *Shard) Insert(row map[string]interface{}) (*ExecResult, error) {
+	return s.InsertContext(context.Background(), row)
+}
+
+func (s *Shard) InsertContext(ctx context.Context, row map[string]interface{}) (*ExecResult, error) {
+	return s.Group.InsertContext(ctx, s.Table, row)
+}
+
+func (s *Shard) BatchInsert(rows []map[string]interface{}) (*ExecResult, error) {
+	return s.BatchInsertContext(context.Background(), rows)
+}
+
+func (s *Shard) BatchInsertContext(ctx context.Context, rows []map[string]interface{}) (*ExecResult, error) {
+	return s.Group.BatchInsertContext(ctx, s.Table, rows)
+}
+
+func (s *Shard) Upsert(row map[string]interface{}, updateColumns ...string) (*ExecResult, error) {
+	return s.UpsertContext(context.Background(), row, updateColumns...)
+}
+
+func (s *Shard) UpsertContext(ctx context.Context, row map[string]interface{}, updateColumns ...string) (*ExecResult, error) {
+	return s.Group.UpsertContext(ctx, s.Table, row, updateColumns...)
+}
+
+func (s *Shard) UpsertWithOption(ctx context.Context, rows []map[string]interface{}, option *UpsertOption) (*ExecResult, error) {
+	return s.Group.UpsertWithOption(ctx, s.Table, rows, option)
+}
+
+func (s *Shard) UpdateAll(set map[string]interface{}, where map[string]interface{}) (*ExecResult, error) {
+	return s.UpdateAllContext(context.Background(), set, where)
+}
+
+func (s *Shard) UpdateAllContext(ctx context.Context, set map[string]interface{}, where map[string]interface{}) (*ExecResult, error) {
+	return s.Group.UpdateAllContext(ctx, s.Table, set, where)
+}
+
+func (s *Shard) DeleteAll(where map[string]interface{}) (*ExecResult, error) {
+	return s.DeleteAllContext(context.Background(), where)
+}
+
+func (s *Shard) DeleteAllContext(ctx context.Context, where map[string]interface{}) (*ExecResult, error) {
+	return s.Group.DeleteAllContext(ctx, s.Table, where)
+}
@@ -0,0 +1,211 @@
+package mysql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	//ER_UNSUPPORTED_PS
+	errCodeUnsupportedPs = 1295
+	//ER_NEED_REPREPARE
+	errCodeNeedReprepare = 1615
+)
+
+type stmtEntry struct {
+	sql     string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// stmtCache 按sql缓存*sql.Stmt的LRU，连接回收后database/sql会在新连接上自动重新prepare；
+// 被淘汰的语句在引用计数归零后才关闭，避免关闭正在使用的语句
+type stmtCache struct {
+	mutex sync.Mutex
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		list:  list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *stmtCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.list.Len()
+}
+
+func (c *stmtCache) acquire(ctx context.Context, db *sql.DB, sqlStr string) (*stmtEntry, error) {
+	c.mutex.Lock()
+	if element, exists := c.items[sqlStr]; exists {
+		c.list.MoveToFront(element)
+		entry := element.Value.(*stmtEntry)
+		entry.refs++
+		c.mutex.Unlock()
+		return entry, nil
+	}
+	c.mutex.Unlock()
+
+	//prepare需要网络请求，不在锁内执行
+	stmt, err := db.PrepareContext(ctx, sqlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	//并发prepare了相同的语句
+	if element, exists := c.items[sqlStr]; exists {
+		_ = stmt.Close()
+		c.list.MoveToFront(element)
+		entry := element.Value.(*stmtEntry)
+		entry.refs++
+		return entry, nil
+	}
+
+	entry := &stmtEntry{sql: sqlStr, stmt: stmt, refs: 1}
+	c.items[sqlStr] = c.list.PushFront(entry)
+
+	for c.list.Len() > c.size {
+		c.removeLocked(c.list.Back().Value.(*stmtEntry))
+	}
+	return entry, nil
+}
+
+// get 只查找已缓存的语句，未命中时返回nil
+func (c *stmtCache) get(sqlStr string) *stmtEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, exists := c.items[sqlStr]
+	if !exists {
+		return nil
+	}
+
+	c.list.MoveToFront(element)
+	entry := element.Value.(*stmtEntry)
+	entry.refs++
+	return entry
+}
+
+func (c *stmtCache) release(entry *stmtEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry.refs--
+	if entry.evicted && entry.refs < 1 {
+		_ = entry.stmt.Close()
+	}
+}
+
+func (c *stmtCache) remove(entry *stmtEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.removeLocked(entry)
+}
+
+func (c *stmtCache) removeLocked(entry *stmtEntry) {
+	if entry.evicted {
+		return
+	}
+
+	if element, exists := c.items[entry.sql]; exists && element.Value == entry {
+		c.list.Remove(element)
+		delete(c.items, entry.sql)
+	}
+
+	entry.evicted = true
+	if entry.refs < 1 {
+		_ = entry.stmt.Close()
+	}
+}
+
+// check 表结构变更等原因需要重新prepare时从缓存中移除
+func (c *stmtCache) check(entry *stmtEntry, err error) {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errCodeNeedReprepare {
+		c.remove(entry)
+	}
+}
+
+func isUnsupportedPs(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errCodeUnsupportedPs
+}
+
+func (c *stmtCache) query(ctx context.Context, db *sql.DB, sqlStr string, args []interface{}) (*sql.Rows, error) {
+	entry, err := c.acquire(ctx, db, sqlStr)
+	if err != nil {
+		if isUnsupportedPs(err) {
+			return db.QueryContext(ctx, sqlStr, args...)
+		}
+		return nil, err
+	}
+	defer c.release(entry)
+
+	//结果集关闭前database/sql不会真正关闭语句
+	rows, err := entry.stmt.QueryContext(ctx, args...)
+	c.check(entry, err)
+	return rows, err
+}
+
+func (c *stmtCache) exec(ctx context.Context, db *sql.DB, sqlStr string, args []interface{}) (sql.Result, error) {
+	entry, err := c.acquire(ctx, db, sqlStr)
+	if err != nil {
+		if isUnsupportedPs(err) {
+			return db.ExecContext(ctx, sqlStr, args...)
+		}
+		return nil, err
+	}
+	defer c.release(entry)
+
+	result, err := entry.stmt.ExecContext(ctx, args...)
+	c.check(entry, err)
+	return result, err
+}
+
+// stmt 事务内命中缓存时通过tx.Stmt复用，引用在事务结束时释放；未命中时在事务连接上prepare，
+// 不从连接池获取新连接(MaxOpenConns较小时会阻塞)，也不写入缓存，事务结束时由database/sql关闭
+func (t *Transaction) stmt(ctx context.Context, sqlStr string) (*sql.Stmt, error) {
+	if stmt, exists := t.txStmts[sqlStr]; exists {
+		return stmt, nil
+	}
+
+	var (
+		stmt *sql.Stmt
+		err  error
+	)
+
+	if entry := t.pool.stmts.get(sqlStr); entry != nil {
+		t.stmts = append(t.stmts, entry)
+		stmt = t.tx.StmtContext(ctx, entry.stmt)
+	} else if stmt, err = t.tx.PrepareContext(ctx, sqlStr); err != nil {
+		return nil, err
+	}
+
+	if t.txStmts == nil {
+		t.txStmts = make(map[string]*sql.Stmt)
+	}
+	t.txStmts[sqlStr] = stmt
+	return stmt, nil
+}
+
+func (t *Transaction) releaseStmts() {
+	for _, entry := range t.stmts {
+		t.pool.stmts.release(entry)
+	}
+	t.stmts, t.txStmts = nil, nil
+}
@@ -0,0 +1,190 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	ErrCodeLockWaitTimeout = 1205
+	ErrCodeDeadlock        = 1213
+)
+
+const (
+	defaultTransactRetries = 3
+	defaultTransactBackoff = 20 * time.Millisecond
+)
+
+type TransactOption struct {
+	TxOptions *sql.TxOptions
+	//死锁或锁等待超时后的最大重试次数
+	MaxRetries int
+	//首次重试前的等待时间，之后每次翻倍并加入随机抖动
+	Backoff time.Duration
+	//事务写入的表，Group提交成功后使其查询缓存失效
+	Tables []string
+}
+
+type TransactHandler func(tx *Transaction) error
+
+func defaultTransactOption() *TransactOption {
+	return &TransactOption{
+		MaxRetries: defaultTransactRetries,
+		Backoff:    defaultTransactBackoff,
+	}
+}
+
+// IsRetryableTxError 是否为死锁(1213)或锁等待超时(1205)错误
+func IsRetryableTxError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == ErrCodeDeadlock || mysqlErr.Number == ErrCodeLockWaitTimeout
+	}
+	return false
+}
+
+// Transact handler返回nil时提交，返回错误或panic时回滚，遇到死锁或锁等待超时时按默认策略重试整个事务
+func (p *Pool) Transact(ctx context.Context, handler TransactHandler) error {
+	return p.TransactWithOption(ctx, defaultTransactOption(), handler)
+}
+
+func (p *Pool) TransactWithOption(ctx context.Context, option *TransactOption, handler TransactHandler) (err error) {
+	if option == nil {
+		option = defaultTransactOption()
+	}
+
+	backoff := option.Backoff
+	for retry := 0; ; retry++ {
+		err = p.transact(ctx, option.TxOptions, handler)
+		if err == nil || retry >= option.MaxRetries || !IsRetryableTxError(err) {
+			return err
+		}
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff + time.Duration(rand.Int63n(int64(backoff))))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+	}
+}
+
+func (p *Pool) transact(ctx context.Context, opts *sql.TxOptions, handler TransactHandler) (err error) {
+	tx, err := p.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if err = runTransactHandler(tx, handler); err != nil {
+		rollbackErr := tx.Rollback()
+		var callbackErr *CallbackError
+		switch {
+		case rollbackErr == nil:
+			return err
+		case errors.As(rollbackErr, &callbackErr):
+			//已回滚，仅回调失败
+			return fmt.Errorf("%w (%v)", err, rollbackErr)
+		default:
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func runTransactHandler(tx *Transaction, handler TransactHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("mysql transaction: panic recovered: %v", r)
+		}
+	}()
+
+	return handler(tx)
+}
+
+// Transact 无法识别事务写入的表，不会使查询缓存失效，需使用TransactWithOption指定Tables或调用InvalidateCache
+func (g *Group) Transact(ctx context.Context, handler TransactHandler) error {
+	return g.TransactWithOption(ctx, defaultTransactOption(), handler)
+}
+
+// TransactWithOption 只选择一次主库，连接断开时不切换主库重试，避免提交已成功的事务及handler中的副作用被重复执行；
+// 提交后先于OnCommit回调标记写入并使Tables的缓存失效，回调失败时同样生效
+func (g *Group) TransactWithOption(ctx context.Context, option *TransactOption, handler TransactHandler) error {
+	committed := func() error {
+		g.markWrite(ctx)
+		if option != nil {
+			for _, table := range option.Tables {
+				g.invalidate(table)
+			}
+		}
+		return nil
+	}
+
+	//事务耗时包含handler的处理时间，不计入延迟统计，事务内的语句单独统计
+	index, pool, badTime := g.GetMaster()
+	err := pool.TransactWithOption(ctx, option, func(tx *Transaction) error {
+		if err := handler(tx); err != nil {
+			return err
+		}
+
+		tx.onCommit = append([]func() error{committed}, tx.onCommit...)
+		return nil
+	})
+	if err == nil {
+		if badTime > 0 {
+			g.upMaster(index)
+		}
+		return nil
+	}
+
+	if g.isLostError(err) {
+		g.downMaster(index, err)
+	} else if badTime > 0 {
+		g.upMaster(index)
+	}
+	return err
+}
+
+// Transact 嵌套事务，使用SAVEPOINT实现，handler返回错误或panic时只回滚到该保存点，
+// 并立即执行保存点内注册的OnRollback回调，丢弃其中注册的OnCommit回调
+func (t *Transaction) Transact(ctx context.Context, handler TransactHandler) (err error) {
+	t.savepoint++
+	savepoint := "sp_" + strconv.Itoa(t.savepoint)
+	defer func() {
+		t.savepoint--
+	}()
+
+	if _, err = t.ExecuteContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+
+	//保存点内注册的回调
+	commitMark, rollbackMark := len(t.onCommit), len(t.onRollback)
+
+	if err = runTransactHandler(t, handler); err != nil {
+		if _, rollbackErr := t.ExecuteContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rollbackErr)
+		}
+
+		rollbackHandlers := append([]func() error(nil), t.onRollback[rollbackMark:]...)
+		t.onCommit, t.onRollback = t.onCommit[:commitMark], t.onRollback[:rollbackMark]
+		if callbackErr := runCallbacks(rollbackHandlers); callbackErr != nil {
+			return fmt.Errorf("%w (%v)", err, callbackErr)
+		}
+		return err
+	}
+
+	_, err = t.ExecuteContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
@@ -1,128 +1,380 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/grpc-boot/boot"
 )
 
+// CallbackError 事务已提交或回滚，但部分回调执行失败
+type CallbackError struct {
+	Errors []error
+}
+
+func (c *CallbackError) Error() string {
+	messages := make([]string, 0, len(c.Errors))
+	for _, err := range c.Errors {
+		messages = append(messages, err.Error())
+	}
+	return "mysql transaction: callback failed: " + strings.Join(messages, "; ")
+}
+
 type Transaction struct {
-	tx *sql.Tx
+	tx         *sql.Tx
+	pool       *Pool
+	savepoint  int
+	onCommit   []func() error
+	onRollback []func() error
+	stmts      []*stmtEntry
+	//事务内已prepare的语句
+	txStmts map[string]*sql.Stmt
+	//已调用过Commit或Rollback
+	done bool
 }
 
-func newTx(tx *sql.Tx) *Transaction {
+func newTx(tx *sql.Tx, pool *Pool) *Transaction {
 	return &Transaction{
-		tx: tx,
+		tx:   tx,
+		pool: pool,
 	}
 }
 
+// OnCommit 注册提交成功后按顺序执行的回调
+func (t *Transaction) OnCommit(handler func() error) {
+	t.onCommit = append(t.onCommit, handler)
+}
+
+// OnRollback 注册回滚后按顺序执行的回调，提交失败时同样会执行
+func (t *Transaction) OnRollback(handler func() error) {
+	t.onRollback = append(t.onRollback, handler)
+}
+
+// Rollback 回滚成功但回调失败时返回*CallbackError；上下文取消或超时时database/sql已自动回滚，
+// 此时同样执行OnRollback回调
 func (t *Transaction) Rollback() error {
-	return t.tx.Rollback()
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	err := t.tx.Rollback()
+	if err == sql.ErrTxDone {
+		err = nil
+	}
+	t.releaseStmts()
+
+	handlers := t.onRollback
+	t.onCommit, t.onRollback = nil, nil
+
+	callbackErr := runCallbacks(handlers)
+	if err != nil {
+		return err
+	}
+	return callbackErr
 }
 
+// Commit 提交成功但回调失败时返回*CallbackError；提交失败(包括上下文取消导致的自动回滚)时执行OnRollback回调
 func (t *Transaction) Commit() error {
-	return t.tx.Commit()
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	err := t.tx.Commit()
+	t.releaseStmts()
+
+	commitHandlers, rollbackHandlers := t.onCommit, t.onRollback
+	t.onCommit, t.onRollback = nil, nil
+	if err != nil {
+		_ = runCallbacks(rollbackHandlers)
+		return err
+	}
+	return runCallbacks(commitHandlers)
+}
+
+func runCallbacks(handlers []func() error) error {
+	var errs []error
+	for _, handler := range handlers {
+		if err := runCallback(handler); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &CallbackError{Errors: errs}
+	}
+	return nil
+}
+
+func runCallback(handler func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	return handler()
 }
 
 func (t *Transaction) Query(sqlStr string, args ...interface{}) (*sql.Rows, error) {
-	return t.tx.Query(sqlStr, args...)
+	return t.QueryContext(context.Background(), sqlStr, args...)
+}
+
+func (t *Transaction) QueryContext(ctx context.Context, sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
+	sqlStr = t.pool.dialect.Rebind(sqlStr)
+	begin := time.Now()
+	defer func() {
+		if err == nil {
+			t.pool.observe(time.Since(begin))
+		}
+	}()
+
+	err = intercept(ctx, t.pool.interceptors, &Statement{Sql: sqlStr, Args: args, Pool: t.pool, InTx: true}, func(ctx context.Context) (e error) {
+		if t.pool.stmts != nil {
+			stmt, e := t.stmt(ctx, sqlStr)
+			if e == nil {
+				rows, e = stmt.QueryContext(ctx, args...)
+				return e
+			}
+
+			if !isUnsupportedPs(e) {
+				return e
+			}
+		}
+
+		rows, e = t.tx.QueryContext(ctx, sqlStr, args...)
+		return
+	})
+	return
 }
 
 func (t *Transaction) Execute(sqlStr string, args ...interface{}) (sql.Result, error) {
-	return t.tx.Exec(sqlStr, args...)
+	return t.ExecuteContext(context.Background(), sqlStr, args...)
+}
+
+func (t *Transaction) ExecuteContext(ctx context.Context, sqlStr string, args ...interface{}) (result sql.Result, err error) {
+	sqlStr = t.pool.dialect.Rebind(sqlStr)
+	begin := time.Now()
+	defer func() {
+		if err == nil {
+			t.pool.observe(time.Since(begin))
+		}
+	}()
+
+	err = intercept(ctx, t.pool.interceptors, &Statement{Sql: sqlStr, Args: args, Pool: t.pool, InTx: true}, func(ctx context.Context) (e error) {
+		if t.pool.stmts != nil {
+			stmt, e := t.stmt(ctx, sqlStr)
+			if e == nil {
+				result, e = stmt.ExecContext(ctx, args...)
+				return e
+			}
+
+			if !isUnsupportedPs(e) {
+				return e
+			}
+		}
+
+		result, e = t.tx.ExecContext(ctx, sqlStr, args...)
+		return
+	})
+	return
 }
 
 func (t *Transaction) Find(query *Query) (*sql.Rows, error) {
-	sqlStr, args := buildQuery(query)
+	return t.FindContext(context.Background(), query)
+}
+
+func (t *Transaction) FindContext(ctx context.Context, query *Query) (*sql.Rows, error) {
+	sqlStr, args, err := buildQuery(query)
+	if err != nil {
+		ReleaseQuery(query)
+		return nil, err
+	}
+
 	defer func() {
 		ReleaseQuery(query)
 		boot.ReleaseArgs(&args)
 	}()
-	return t.tx.Query(sqlStr, args...)
+	return t.QueryContext(ctx, sqlStr, args...)
+}
+
+func (t *Transaction) FindAll(query *Query, dest interface{}) error {
+	return t.FindAllContext(context.Background(), query, dest)
+}
+
+func (t *Transaction) FindAllContext(ctx context.Context, query *Query, dest interface{}) error {
+	rows, err := t.FindContext(ctx, query.Model(dest))
+	if err != nil {
+		return err
+	}
+
+	return Rows2Objs(rows, dest)
 }
 
 func (t *Transaction) Insert(table string, row map[string]interface{}) (result *ExecResult, err error) {
-	var (
-		sqlStr string
-		args   []interface{}
-	)
+	return t.InsertContext(context.Background(), table, row)
+}
 
-	sqlStr, args = buildInsertByMap(table, row)
+func (t *Transaction) InsertContext(ctx context.Context, table string, row map[string]interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := buildInsertByMap(table, row)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := t.tx.Exec(sqlStr, args...)
+	result, err = t.exec(ctx, sqlStr, args)
 	boot.ReleaseArgs(&args)
+	return
+}
+
+func (t *Transaction) BatchInsert(table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return t.BatchInsertContext(context.Background(), table, rows)
+}
+
+// BatchInsertContext 按默认的行数及字节数上限拆分执行
+func (t *Transaction) BatchInsertContext(ctx context.Context, table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return t.batchInsert(ctx, table, splitRows(table, rows, nil))
+}
+
+func (t *Transaction) Upsert(table string, row map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return t.UpsertContext(context.Background(), table, row, updateColumns...)
+}
+
+func (t *Transaction) UpsertContext(ctx context.Context, table string, row map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return t.UpsertWithOption(ctx, table, []map[string]interface{}{row}, &UpsertOption{UpdateColumns: updateColumns})
+}
+
+func (t *Transaction) BatchUpsert(table string, rows []map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return t.BatchUpsertContext(context.Background(), table, rows, updateColumns...)
+}
+
+func (t *Transaction) BatchUpsertContext(ctx context.Context, table string, rows []map[string]interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return t.UpsertWithOption(ctx, table, rows, &UpsertOption{UpdateColumns: updateColumns})
+}
+
+// UpsertWithOption PostgreSQL需通过option.Keys指定冲突检测字段
+func (t *Transaction) UpsertWithOption(ctx context.Context, table string, rows []map[string]interface{}, option *UpsertOption) (result *ExecResult, err error) {
+	keys, updateColumns := option.fields()
+	sqlStr, args, err := buildUpsert(t.pool.dialect, table, keys, updateColumns, rows...)
 	if err != nil {
 		return nil, err
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
-	if err != nil {
-		return nil, err
+	result, err = t.exec(ctx, sqlStr, args)
+	if len(rows) == 1 {
+		boot.ReleaseArgs(&args)
 	}
+	return
+}
+
+func (t *Transaction) Replace(table string, row map[string]interface{}) (result *ExecResult, err error) {
+	return t.ReplaceContext(context.Background(), table, row)
+}
 
-	result.LastInsertId, err = res.LastInsertId()
+func (t *Transaction) ReplaceContext(ctx context.Context, table string, row map[string]interface{}) (result *ExecResult, err error) {
+	if !t.pool.dialect.SupportsReplace() {
+		return nil, ErrUnsupportedDialect
+	}
+
+	sqlStr, args, err := buildReplaceByMap(table, row)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = t.exec(ctx, sqlStr, args)
+	boot.ReleaseArgs(&args)
 	return
 }
 
-func (t *Transaction) BatchInsert(table string, rows []map[string]interface{}) (result *ExecResult, err error) {
-	var (
-		sqlStr string
-		args   []interface{}
-	)
+func (t *Transaction) BatchReplace(table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	return t.BatchReplaceContext(context.Background(), table, rows)
+}
 
-	sqlStr, args = buildInsertByMap(table, rows...)
+func (t *Transaction) BatchReplaceContext(ctx context.Context, table string, rows []map[string]interface{}) (result *ExecResult, err error) {
+	if !t.pool.dialect.SupportsReplace() {
+		return nil, ErrUnsupportedDialect
+	}
 
-	res, err := t.tx.Exec(sqlStr, args...)
+	sqlStr, args, err := buildReplaceByMap(table, rows...)
 	if err != nil {
 		return nil, err
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+	return t.exec(ctx, sqlStr, args)
+}
+
+func (t *Transaction) UpsertObj(obj interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	return t.UpsertObjContext(context.Background(), obj, updateColumns...)
+}
+
+func (t *Transaction) UpsertObjContext(ctx context.Context, obj interface{}, updateColumns ...string) (result *ExecResult, err error) {
+	sqlStr, args, err := buildUpsertByObj(t.pool.dialect, obj, updateColumns)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = t.exec(ctx, sqlStr, args)
+	boot.ReleaseArgs(&args)
 	return
 }
 
-func (t *Transaction) UpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
-	sqlStr, args := buildUpdateAll(table, set, where)
-	res, err := t.tx.Exec(sqlStr, args...)
-	boot.ReleaseArgs(&args)
+func (t *Transaction) ReplaceObj(obj interface{}) (result *ExecResult, err error) {
+	return t.ReplaceObjContext(context.Background(), obj)
+}
+
+func (t *Transaction) ReplaceObjContext(ctx context.Context, obj interface{}) (result *ExecResult, err error) {
+	if !t.pool.dialect.SupportsReplace() {
+		return nil, ErrUnsupportedDialect
+	}
+
+	sqlStr, args, err := BuildReplaceByObj(obj)
 	if err != nil {
 		return nil, err
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+	result, err = t.exec(ctx, sqlStr, args)
+	boot.ReleaseArgs(&args)
+	return
+}
+
+func (t *Transaction) UpdateAll(table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
+	return t.UpdateAllContext(context.Background(), table, set, where)
+}
+
+func (t *Transaction) UpdateAllContext(ctx context.Context, table string, set map[string]interface{}, where map[string]interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := buildUpdateAll(table, set, where)
 	if err != nil {
 		return nil, err
 	}
 
+	result, err = t.exec(ctx, sqlStr, args)
+	boot.ReleaseArgs(&args)
 	return
 }
 
 func (t *Transaction) DeleteAll(table string, where map[string]interface{}) (result *ExecResult, err error) {
-	sqlStr, args := buildDeleteAll(table, where)
-	res, err := t.tx.Exec(sqlStr, args...)
-	boot.ReleaseArgs(&args)
+	return t.DeleteAllContext(context.Background(), table, where)
+}
+
+func (t *Transaction) DeleteAllContext(ctx context.Context, table string, where map[string]interface{}) (result *ExecResult, err error) {
+	sqlStr, args, err := buildDeleteAll(table, where)
 	if err != nil {
 		return nil, err
 	}
 
-	result = &ExecResult{}
-	result.AffectedRows, err = res.RowsAffected()
+	result, err = t.exec(ctx, sqlStr, args)
+	boot.ReleaseArgs(&args)
+	return
+}
+
+func (t *Transaction) exec(ctx context.Context, sqlStr string, args []interface{}) (result *ExecResult, err error) {
+	res, err := t.ExecuteContext(ctx, sqlStr, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return
+	return newExecResult(res)
 }